@@ -11,6 +11,7 @@ require (
 	github.com/pkg/browser v0.0.0-20180916011732-0a3d74bf9ce4
 	github.com/sergi/go-diff v1.0.0
 	github.com/yaegashi/msgraph.go v0.1.2
+	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
 	golang.org/x/tools v0.0.0-20200216192241-b320d3a0f5a2
 )
@@ -2,12 +2,18 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/plugin"
 	"github.com/magodo/terraform-provider-outlook/outlook/provider"
 )
 
 func main() {
+	// terraform runs the provider without any argument, while the arguments are the subcommands managing the token cache.
+	if len(os.Args) > 1 {
+		os.Exit(provider.RunCommand(os.Args[1:]))
+	}
+
 	// remove date and time stamp from log output as the plugin SDK already adds its own
 	log.SetFlags(log.Flags() &^ (log.Ldate | log.Ltime))
 	plugin.Serve(&plugin.ServeOpts{
@@ -0,0 +1,216 @@
+package msauth
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// Account is the signed-in account of a delegated token, which is decoded from the ID token.
+type Account struct {
+	// HomeAccountID identifies the account across tenants, in the form of "<object id>.<tenant id>".
+	HomeAccountID string
+	// Username is the sign-in name of the account, e.g. "john@contoso.com".
+	Username string
+}
+
+// tokenAccount returns the account of the token from its ID token, it returns nil if there is no ID token.
+func tokenAccount(t *oauth2.Token) *Account {
+	claims, err := IDTokenClaims(t)
+	if err != nil || claims.ObjectID == "" {
+		return nil
+	}
+	return &Account{
+		HomeAccountID: claims.ObjectID + "." + claims.TenantID,
+		Username:      claims.Username(),
+	}
+}
+
+// accountSeparator separates the client identifier and the account in the key of the token cache.
+const accountSeparator = " # "
+
+// cacheKey is the key of the token cache, which identifies the client and the account (if known) of the token, so that
+// the tokens of different accounts are cached apart.
+func cacheKey(clientID string, account *Account) string {
+	if account == nil {
+		return clientID
+	}
+	return fmt.Sprintf("%s%s%s %s", clientID, accountSeparator, account.HomeAccountID, account.Username)
+}
+
+// parseCacheKey parses the key built by cacheKey, the account is nil if it is unknown.
+func parseCacheKey(key string) (string, *Account) {
+	i := strings.LastIndex(key, accountSeparator)
+	if i == -1 {
+		return key, nil
+	}
+	fields := strings.Fields(key[i+len(accountSeparator):])
+	if len(fields) == 0 {
+		return key, nil
+	}
+	account := &Account{HomeAccountID: fields[0]}
+	if len(fields) > 1 {
+		account.Username = fields[1]
+	}
+	return key[:i], account
+}
+
+// oidcScopes returns the scopes with the OpenID Connect scopes added (if absent), so that an ID token is issued
+// together with the access token, which tells the signed-in account.
+func oidcScopes(scopes []string) []string {
+	result := append([]string{}, scopes...)
+	for _, oidc := range []string{"openid", "profile"} {
+		found := false
+		for _, scope := range scopes {
+			if strings.EqualFold(scope, oidc) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, oidc)
+		}
+	}
+	return result
+}
+
+// LoginOptions customizes the interactive login.
+type LoginOptions struct {
+	// LoginHint is the username of the account to sign in, e.g. "john@contoso.com". It pre-fills the username on the
+	// sign-in page, selects the cached token of the account, and the login fails if another account is signed in.
+	LoginHint string
+	// DomainHint skips the home realm discovery on the sign-in page, e.g. "consumers", "organizations" or the domain
+	// of a tenant.
+	DomainHint string
+	// Prompt is the type of user interaction required on the sign-in page, i.e. "login", "select_account", "consent"
+	// or "none".
+	Prompt string
+}
+
+// addParams adds the non-empty options as the parameters of the authorization request.
+func (opts LoginOptions) addParams(params map[string][]string) {
+	for k, v := range map[string]string{"login_hint": opts.LoginHint, "domain_hint": opts.DomainHint, "prompt": opts.Prompt} {
+		if v != "" {
+			params[k] = []string{v}
+		}
+	}
+}
+
+// WithLoginOptions returns a copy of the interactive client (i.e. created by NewClientViaAuthorizationCodeFlow or
+// NewClientViaDeviceFlow) with the login options. Other clients are returned as is.
+func WithLoginOptions(client Client, opts LoginOptions) Client {
+	switch c := client.(type) {
+	case *clientViaAuthorizationCodeFlow:
+		cc := *c
+		cc.login = opts
+		return &cc
+	case *clientViaDeviceFlow:
+		cc := *c
+		cc.login = opts
+		return &cc
+	}
+	return client
+}
+
+// loginOptions returns the login options of the client.
+func loginOptions(client Client) LoginOptions {
+	switch c := client.(type) {
+	case *clientViaAuthorizationCodeFlow:
+		return c.login
+	case *clientViaDeviceFlow:
+		return c.login
+	case *clientViaPassword:
+		// The user to sign in is always known.
+		return LoginOptions{LoginHint: c.username}
+	}
+	return LoginOptions{}
+}
+
+// verifyAccount verifies the signed-in account of the token matches the login hint (if any).
+func (opts LoginOptions) verifyAccount(t *oauth2.Token) error {
+	if opts.LoginHint == "" {
+		return nil
+	}
+	account := tokenAccount(t)
+	if account == nil || account.Username == "" {
+		// E.g. the scopes are explicitly specified without "openid".
+		return nil
+	}
+	if !strings.EqualFold(account.Username, opts.LoginHint) {
+		return fmt.Errorf("signed in as %q, while the login hint is %q", account.Username, opts.LoginHint)
+	}
+	return nil
+}
+
+// cachedToken finds the cached token of the client. If a login hint is specified, only the token of that account is
+// selected. Otherwise, the token of the only cached account is selected. It returns a nil token if none is cached.
+// The token cached for the client is preferred. Otherwise, the refresh token cached for other scopes of the same client
+// ID and token URL (e.g. by the former versions) is returned, which is redeemed for the scopes of the client, as the
+// refresh tokens are not bound to the scopes. Of the same account, the one whose scopes cover the ones of the client
+// is preferred, which are consented already.
+func (app *App) cachedToken(client Client) (string, *oauth2.Token, error) {
+	app.tokenCache.mutex.RLock()
+	defer app.tokenCache.mutex.RUnlock()
+
+	clientID, tokenURL, scopes, _ := parseClientIdentifier(client.ID())
+	hint := loginOptions(client).LoginHint
+	var exact, others []string
+	for key, t := range app.tokenCache.cache {
+		id, account := parseCacheKey(key)
+		if hint != "" && (account == nil || !strings.EqualFold(account.Username, hint)) {
+			continue
+		}
+		if id == client.ID() {
+			exact = append(exact, key)
+			continue
+		}
+		if cachedClientID, cachedTokenURL, _, ok := parseClientIdentifier(id); ok && cachedClientID == clientID && cachedTokenURL == tokenURL && t.RefreshToken != "" {
+			others = append(others, key)
+		}
+	}
+	keys := exact
+	if len(keys) == 0 {
+		keys = others
+	}
+	sort.Strings(keys)
+
+	covers := func(key string) bool {
+		id, _ := parseCacheKey(key)
+		_, _, cachedScopes, _ := parseClientIdentifier(id)
+		return scopesCover(cachedScopes, scopes)
+	}
+	var accountIDs, usernames []string
+	selected := map[string]string{}
+	for _, key := range keys {
+		_, account := parseCacheKey(key)
+		username, accountID := "(unknown)", ""
+		if account != nil {
+			username, accountID = account.Username, account.HomeAccountID
+		}
+		prev, ok := selected[accountID]
+		if !ok {
+			accountIDs = append(accountIDs, accountID)
+			usernames = append(usernames, username)
+			selected[accountID] = key
+			continue
+		}
+		if !covers(prev) && covers(key) {
+			selected[accountID] = key
+		}
+	}
+	switch len(accountIDs) {
+	case 0:
+		return "", nil, nil
+	case 1:
+		key := selected[accountIDs[0]]
+		t := app.tokenCache.cache[key]
+		if id, _ := parseCacheKey(key); id != client.ID() {
+			// The access token is dropped, so that the token of the scopes of the client is obtained by the refresh token.
+			t = &oauth2.Token{RefreshToken: t.RefreshToken}
+		}
+		return key, t, nil
+	}
+	return "", nil, fmt.Errorf("tokens of multiple accounts are cached for the client, specify the login hint to select one of: %s", strings.Join(usernames, ", "))
+}
@@ -0,0 +1,233 @@
+package msauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/magodo/terraform-provider-outlook/msauth"
+)
+
+// newTestAccountTokenServer starts a token endpoint, which issues the token of the user named by the authorization code
+// (or the refresh token issued before), together with the ID token of the user. The refresh token is only redeemed for
+// the scopes consented by the user at login, where the read-write scopes imply the read ones.
+func newTestAccountTokenServer(t *testing.T) *httptest.Server {
+	var mutex sync.Mutex
+	consented := map[string]map[string]bool{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if !strings.Contains(r.PostForm.Get("scope"), "openid") {
+			t.Error("openid is not requested")
+		}
+		scopes := strings.Fields(strings.ToLower(r.PostForm.Get("scope")))
+		mutex.Lock()
+		defer mutex.Unlock()
+		user := r.PostForm.Get("code")
+		if r.PostForm.Get("grant_type") == "refresh_token" {
+			user = strings.TrimPrefix(r.PostForm.Get("refresh_token"), "rt-")
+			for _, scope := range scopes {
+				if !consented[user][scope] && !consented[user][strings.TrimSuffix(scope, ".read")+".readwrite"] {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusBadRequest)
+					json.NewEncoder(w).Encode(map[string]interface{}{"error": "invalid_grant", "suberror": "consent_required"})
+					return
+				}
+			}
+		} else {
+			if consented[user] == nil {
+				consented[user] = map[string]bool{}
+			}
+			for _, scope := range scopes {
+				consented[user][scope] = true
+			}
+		}
+		idToken := newTestJWT(t, map[string]interface{}{
+			"oid":                user + "-oid",
+			"tid":                "tenant",
+			"preferred_username": user + "@contoso.com",
+		})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "at-" + user,
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+			"refresh_token": "rt-" + user,
+			"id_token":      idToken,
+		})
+	}))
+}
+
+// signInAs returns an AuthorizationURLCallback playing as the browser, where the user signs in.
+// The login hint in the authorization request is recorded into "hint".
+func signInAs(t *testing.T, user string, hint *string) msauth.AuthorizationURLCallback {
+	return func(authURL string) error {
+		if user == "" {
+			return errors.New("unexpected login")
+		}
+		u, err := url.Parse(authURL)
+		if err != nil {
+			return err
+		}
+		if hint != nil {
+			*hint = u.Query().Get("login_hint")
+		}
+		redirectURL, err := url.Parse(u.Query().Get("redirect_uri"))
+		if err != nil {
+			return err
+		}
+		redirectURL.RawQuery = url.Values{"code": {user}, "state": {u.Query().Get("state")}}.Encode()
+		resp, err := http.Get(redirectURL.String())
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+}
+
+func TestApp_accounts(t *testing.T) {
+	tokenServer := newTestAccountTokenServer(t)
+	defer tokenServer.Close()
+	authority := msauth.Authority{Host: tokenServer.URL, TenantID: "common"}
+	newClient := func(user string, hint *string, opts msauth.LoginOptions) msauth.Client {
+		client := msauth.NewClientViaAuthorizationCodeFlow(authority, "client", nil, "http://localhost", signInAs(t, user, hint), "mail.read")
+		return msauth.WithLoginOptions(client, opts)
+	}
+
+	app := msauth.NewApp()
+	ctx := context.Background()
+	for _, user := range []string{"alice", "bob"} {
+		var hint string
+		if err := app.Login(ctx, newClient(user, &hint, msauth.LoginOptions{LoginHint: user + "@contoso.com"})); err != nil {
+			t.Fatal(err)
+		}
+		if hint != user+"@contoso.com" {
+			t.Fatalf("expect login hint to be passed, got %q", hint)
+		}
+	}
+
+	// The tokens of different accounts are cached apart.
+	entries := app.CacheEntries()
+	if len(entries) != 2 {
+		t.Fatalf("expect 2 cache entries, got %d", len(entries))
+	}
+	for i, user := range []string{"alice", "bob"} {
+		account := entries[i].Account
+		if account == nil || account.Username != user+"@contoso.com" || account.HomeAccountID != user+"-oid.tenant" {
+			t.Fatalf("unexpected account of entry %d: %+v", i, account)
+		}
+		if entries[i].ClientID != "client" {
+			t.Fatalf("unexpected client ID of entry %d: %s", i, entries[i].ClientID)
+		}
+	}
+
+	// The login hint selects the cached token of the account, without login.
+	ts, err := app.ObtainTokenSourceViaClient(ctx, newClient("", nil, msauth.LoginOptions{LoginHint: "BOB@contoso.com"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "at-bob" {
+		t.Fatalf("expect the token of bob, got %s", token.AccessToken)
+	}
+
+	// The cached token is ambiguous without login hint.
+	if _, err := app.ObtainTokenSourceViaClient(ctx, newClient("", nil, msauth.LoginOptions{})); err == nil || !strings.Contains(err.Error(), "alice@contoso.com, bob@contoso.com") {
+		t.Fatalf("expect ambiguous accounts error, got %v", err)
+	}
+
+	// Signing in as another account than the login hint fails.
+	_, err = app.ObtainTokenSourceViaClient(ctx, newClient("alice", nil, msauth.LoginOptions{LoginHint: "carol@contoso.com"}))
+	if err == nil || !strings.Contains(err.Error(), `signed in as "alice@contoso.com"`) {
+		t.Fatalf("expect account mismatch error, got %v", err)
+	}
+	if len(app.CacheEntries()) != 2 {
+		t.Fatal("expect the token of the mismatched account not cached")
+	}
+}
+
+func TestApp_coveringScopes(t *testing.T) {
+	tokenServer := newTestAccountTokenServer(t)
+	defer tokenServer.Close()
+	authority := msauth.Authority{Host: tokenServer.URL, TenantID: "common"}
+	newClient := func(user string, scopes ...string) msauth.Client {
+		return msauth.NewClientViaAuthorizationCodeFlow(authority, "client", nil, "http://localhost", signInAs(t, user, nil), scopes...)
+	}
+
+	app := msauth.NewApp()
+	ctx := context.Background()
+	if err := app.Login(ctx, newClient("alice", "Mail.ReadWrite", "User.Read", "offline_access")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The refresh token cached for broader scopes is redeemed by the client of narrower scopes, without login.
+	ts, err := app.ObtainTokenSourceViaClient(ctx, newClient("", "Mail.Read", "offline_access"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "at-alice" {
+		t.Fatalf("expect the token of alice, got %s", token.AccessToken)
+	}
+	entries := app.CacheEntries()
+	if len(entries) != 2 || strings.Join(entries[0].Scopes, " ") != "mail.read offline_access" || strings.Join(entries[1].Scopes, " ") != "mail.readwrite offline_access user.read" {
+		t.Fatalf("expect the token of broader scopes kept, got %+v", entries)
+	}
+
+	// The cached tokens don't cover the client of other scopes, which logs in.
+	if _, err := app.ObtainTokenSourceViaClient(ctx, newClient("", "Calendars.Read", "offline_access")); err == nil || !strings.Contains(err.Error(), "unexpected login") {
+		t.Fatalf("expect login, got %v", err)
+	}
+}
+
+func TestApp_accountsReloaded(t *testing.T) {
+	tokenServer := newTestAccountTokenServer(t)
+	defer tokenServer.Close()
+	authority := msauth.Authority{Host: tokenServer.URL, TenantID: "common"}
+	newClient := func(user string, opts msauth.LoginOptions) msauth.Client {
+		client := msauth.NewClientViaAuthorizationCodeFlow(authority, "client", nil, "http://localhost", signInAs(t, user, nil), "mail.read")
+		return msauth.WithLoginOptions(client, opts)
+	}
+	// newApp returns a new App sharing the store, as another run of terraform does.
+	store := msauth.NewMemoryTokenCacheStore()
+	newApp := func() *msauth.App {
+		app := msauth.NewApp()
+		if err := app.SyncCache(context.Background(), store); err != nil {
+			t.Fatal(err)
+		}
+		return app
+	}
+
+	ctx := context.Background()
+	if err := newApp().Login(ctx, newClient("alice", msauth.LoginOptions{})); err != nil {
+		t.Fatal(err)
+	}
+
+	// The ID token is not cached, while the reloaded token is still saved under its account, with or without login hint.
+	for _, opts := range []msauth.LoginOptions{{}, {LoginHint: "alice@contoso.com"}, {}} {
+		ts, err := newApp().ObtainTokenSourceViaClient(ctx, newClient("", opts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ts.Token(); err != nil {
+			t.Fatal(err)
+		}
+		entries := newApp().CacheEntries()
+		if len(entries) != 1 || entries[0].Account == nil || entries[0].Account.Username != "alice@contoso.com" {
+			t.Fatalf("expect only the token of alice cached, got %+v", entries)
+		}
+	}
+}
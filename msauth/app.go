@@ -3,14 +3,25 @@ package msauth
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"log"
+	"sort"
 	"sync"
+	"time"
 
 	"golang.org/x/oauth2"
 )
 
 type App struct {
 	tokenCache tokenCache
+
+	// store is where every obtained or refreshed token is written back to, if not nil.
+	store TokenCacheStore
+
+	// cipher encrypts the token cache at rest, if not nil.
+	cipher *cacheCipher
 }
 
 type tokenCache struct {
@@ -30,49 +41,294 @@ func (c *tokenCache) Set(k string, v *oauth2.Token) {
 	c.cache[k] = v
 }
 
+// SetCachePassphrase makes the token cache encrypted at rest, by a key derived from the passphrase.
+// Both the encrypted and the plain token cache can be imported afterwards.
+func (app *App) SetCachePassphrase(passphrase string) {
+	if passphrase == "" {
+		app.cipher = nil
+		return
+	}
+	app.cipher = &cacheCipher{passphrase: passphrase}
+}
+
+// ImportCache imports the token cache from the file at "path", which is either encrypted or not.
 func (app *App) ImportCache(path string) error {
-	app.tokenCache.mutex.Lock()
-	defer app.tokenCache.mutex.Unlock()
 	b, err := ioutil.ReadFile(path)
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(b, &app.tokenCache.cache)
+	_, err = app.importCache(b)
+	return err
+}
+
+// importCache is similar to ImportCache, except it imports from the serialized token cache, and additionally
+// tells whether it is encrypted.
+func (app *App) importCache(b []byte) (bool, error) {
+	app.tokenCache.mutex.Lock()
+	defer app.tokenCache.mutex.Unlock()
+	return app.unmarshalCache(b, &app.tokenCache.cache)
+}
+
+// unmarshalCache unmarshals the serialized token cache "b" into "cache", and tells whether "b" is encrypted.
+func (app *App) unmarshalCache(b []byte, cache *map[string]*oauth2.Token) (bool, error) {
+	encrypted := isEncryptedCache(b)
+	if encrypted {
+		if app.cipher == nil {
+			return true, errors.New("the token cache is encrypted, while no passphrase is specified")
+		}
+		var err error
+		b, err = app.cipher.decrypt(b)
+		if err != nil {
+			return true, err
+		}
+	}
+	if err := json.Unmarshal(b, cache); err != nil {
+		return encrypted, fmt.Errorf("unmarshalling token cache: %w", err)
+	}
+	return encrypted, nil
 }
 
+// marshalCache serializes the token cache, which is encrypted if a passphrase is set.
+func (app *App) marshalCache(cache map[string]*oauth2.Token) ([]byte, error) {
+	b, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if app.cipher == nil {
+		return b, nil
+	}
+	return app.cipher.encrypt(b)
+}
+
+// ExportCache writes the whole token cache into the file at "path". The entries that only exist in the file
+// (e.g. written by other processes) are kept.
 func (app *App) ExportCache(path string) error {
+	app.tokenCache.mutex.RLock()
+	defer app.tokenCache.mutex.RUnlock()
+	return app.updateStore(context.Background(), NewFileTokenCacheStore(path), func(cache map[string]*oauth2.Token) {
+		for k, v := range app.tokenCache.cache {
+			cache[k] = v
+		}
+	})
+}
+
+// CacheEntry describes a token in the token cache.
+type CacheEntry struct {
+	// ID identifies the client which obtained the token, and the signed-in account (if known).
+	ID       string
+	ClientID string
+	TokenURL string
+	Scopes   []string
+	// Account is the signed-in account of the token, which is nil if unknown (e.g. cached by the former versions).
+	Account *Account
+
+	// Expiry is the expiry of the access token, the refresh token (if any) typically lives much longer.
+	Expiry          time.Time
+	HasRefreshToken bool
+}
+
+func newCacheEntry(id string, t *oauth2.Token) CacheEntry {
+	entry := CacheEntry{ID: id, Expiry: t.Expiry, HasRefreshToken: t.RefreshToken != ""}
+	var clientID string
+	clientID, entry.Account = parseCacheKey(id)
+	entry.ClientID, entry.TokenURL, entry.Scopes, _ = parseClientIdentifier(clientID)
+	return entry
+}
+
+// CacheEntries lists the entries in the token cache, sorted by ID.
+func (app *App) CacheEntries() []CacheEntry {
+	app.tokenCache.mutex.RLock()
+	defer app.tokenCache.mutex.RUnlock()
+	var entries []CacheEntry
+	for id, t := range app.tokenCache.cache {
+		entries = append(entries, newCacheEntry(id, t))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries
+}
+
+// RemoveCacheEntries removes the entries matched by "match" from the token cache, and from the store if any.
+// It returns the number of removed entries.
+func (app *App) RemoveCacheEntries(ctx context.Context, match func(CacheEntry) bool) (int, error) {
 	app.tokenCache.mutex.Lock()
 	defer app.tokenCache.mutex.Unlock()
-	b, err := json.MarshalIndent(app.tokenCache.cache, "", "  ")
+	removed := map[string]bool{}
+	remove := func(cache map[string]*oauth2.Token) {
+		for id, t := range cache {
+			if match(newCacheEntry(id, t)) {
+				delete(cache, id)
+				removed[id] = true
+			}
+		}
+	}
+	remove(app.tokenCache.cache)
+	if app.store != nil {
+		if err := app.updateStore(ctx, app.store, remove); err != nil {
+			return 0, fmt.Errorf("writing token cache: %w", err)
+		}
+	}
+	return len(removed), nil
+}
+
+// SyncCache imports the token cache from the store. Afterwards, every token obtained or refreshed by this App is
+// written back to the store, so that the rotated refresh tokens are not lost.
+func (app *App) SyncCache(ctx context.Context, store TokenCacheStore) error {
+	b, err := store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	app.store = store
+	if b == nil {
+		return nil
+	}
+	encrypted, err := app.importCache(b)
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(path, b, 0644)
+
+	// Migrate the existing plain token cache to the encrypted one.
+	if !encrypted && app.cipher != nil {
+		if err := app.updateStore(ctx, store, func(map[string]*oauth2.Token) {}); err != nil {
+			return fmt.Errorf("encrypting token cache: %w", err)
+		}
+	}
+	return nil
 }
 
-func (app *App) ObtainTokenSourceViaClientCredential(ctx context.Context, tenantID string, clientID, clientCredential string, scopes ...string) (oauth2.TokenSource, error) {
-	return NewClientCredentialClient(tenantID, clientID, clientCredential, scopes...).ObtainTokenSource(ctx)
+// updateStore updates the token cache in the store by "f". The token cache is encrypted if a passphrase is set.
+func (app *App) updateStore(ctx context.Context, store TokenCacheStore, f func(cache map[string]*oauth2.Token)) error {
+	return store.Update(ctx, func(current []byte) ([]byte, error) {
+		cache := map[string]*oauth2.Token{}
+		if current != nil {
+			if _, err := app.unmarshalCache(current, &cache); err != nil {
+				return nil, err
+			}
+		}
+		f(cache)
+		return app.marshalCache(cache)
+	})
 }
 
-func (app *App) ObtainTokenSourceViaDeviceFlow(ctx context.Context, tenantID string, clientID string, f DeviceAuthorizationCallback, scopes ...string) (oauth2.TokenSource, error) {
-	return app.obtainTokenSourceViaClient(ctx, NewClientViaDeviceFlow(tenantID, clientID, f, scopes...))
+// saveToken saves the token into the token cache, and writes it back to the store if any.
+// Only the entry of this token is written, in order not to override the entries updated by other processes meanwhile.
+func (app *App) saveToken(ctx context.Context, key string, t *oauth2.Token) error {
+	app.tokenCache.Set(key, t)
+	if app.store == nil {
+		return nil
+	}
+	if err := app.updateStore(ctx, app.store, func(cache map[string]*oauth2.Token) { cache[key] = t }); err != nil {
+		return fmt.Errorf("writing token cache: %w", err)
+	}
+	return nil
 }
 
-func (app *App) ObtainTokenSourceViaAuthorizationCodeFlow(ctx context.Context, tenantID, clientID, clientSecret, redirectURL string, scopes ...string) (oauth2.TokenSource, error) {
-	return app.obtainTokenSourceViaClient(ctx, NewClientViaAuthorizationCodeFlow(tenantID, clientID, clientSecret, redirectURL, scopes...))
+// cachingTokenSource saves every new token returned from the underlying token source into the token cache of the App.
+type cachingTokenSource struct {
+	app  *App
+	key  string
+	base oauth2.TokenSource
+
+	mutex sync.Mutex
+	last  *oauth2.Token
+}
+
+func (s *cachingTokenSource) Token() (*oauth2.Token, error) {
+	t, err := s.base.Token()
+	if err != nil {
+		return nil, err
+	}
+	s.save(t)
+	return t, nil
+}
+
+func (s *cachingTokenSource) TokenWithClaims(claims string) (*oauth2.Token, error) {
+	base, ok := s.base.(ClaimsTokenSource)
+	if !ok {
+		return nil, errors.New("the token source doesn't support claims challenge")
+	}
+	t, err := base.TokenWithClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+	s.save(t)
+	return t, nil
+}
+
+func (s *cachingTokenSource) save(t *oauth2.Token) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// The underlying token source is a reuse token source, which returns the same token until it is refreshed.
+	if t != s.last {
+		// The token is refreshed regardless of the request, hence the store is only bounded by its own timeout (if any).
+		if err := s.app.saveToken(context.Background(), s.key, t); err != nil {
+			log.Printf("[WARN] %v", err)
+		}
+		s.last = t
+	}
+}
+
+func (app *App) ObtainTokenSourceViaClientCredential(ctx context.Context, authority Authority, clientID string, credential ClientCredential, scopes ...string) (oauth2.TokenSource, error) {
+	return NewClientCredentialClient(authority, clientID, credential, scopes...).ObtainTokenSource(ctx)
+}
+
+func (app *App) ObtainTokenSourceViaDeviceFlow(ctx context.Context, authority Authority, clientID string, f DeviceAuthorizationCallback, scopes ...string) (oauth2.TokenSource, error) {
+	return app.ObtainTokenSourceViaClient(ctx, NewClientViaDeviceFlow(authority, clientID, f, scopes...))
 }
 
-func (app *App) obtainTokenSourceViaClient(ctx context.Context, client Client) (oauth2.TokenSource, error) {
-	t := app.tokenCache.Get(client.ID())
+func (app *App) ObtainTokenSourceViaAuthorizationCodeFlow(ctx context.Context, authority Authority, clientID string, credential ClientCredential, redirectURL string, f AuthorizationURLCallback, scopes ...string) (oauth2.TokenSource, error) {
+	return app.ObtainTokenSourceViaClient(ctx, NewClientViaAuthorizationCodeFlow(authority, clientID, credential, redirectURL, f, scopes...))
+}
+
+// Login obtains a new token via the client regardless of the cached one (if any), and saves it into the token cache.
+func (app *App) Login(ctx context.Context, client Client) error {
+	t, err := app.login(ctx, client)
+	if err != nil {
+		return err
+	}
+	_, err = app.saveAccountToken(ctx, client, "", t)
+	return err
+}
+
+// login obtains a new token via the client, and verifies the signed-in account matches the login hint (if any).
+func (app *App) login(ctx context.Context, client Client) (*oauth2.Token, error) {
+	t, err := client.ObtainToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := loginOptions(client).verifyAccount(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ObtainTokenSourceViaClient obtains the token source of the client from the cached token, or logs in via the client if
+// no token is cached (see WithLoginOptions for selecting the account).
+func (app *App) ObtainTokenSourceViaClient(ctx context.Context, client Client) (oauth2.TokenSource, error) {
+	key, t, err := app.cachedToken(client)
+	if err != nil {
+		return nil, err
+	}
+	if id, _ := parseCacheKey(key); t != nil && id != client.ID() {
+		ts, err := app.newCachingTokenSource(ctx, client, key, t)
+		if err == nil {
+			return ts, nil
+		}
+		// E.g. the scopes of the client are not consented yet.
+		log.Printf("[DEBUG] redeeming the refresh token cached for other scopes: %v", err)
+		t = nil
+	}
 	if t == nil {
-		var err error
-		t, err = client.ObtainToken(ctx)
-		if err != nil {
+		if t, err = app.login(ctx, client); err != nil {
 			return nil, err
 		}
-		app.tokenCache.Set(client.ID(), t)
-		return client.ObtainTokenSource(ctx, t)
+		key = ""
 	}
+	return app.newCachingTokenSource(ctx, client, key, t)
+}
+
+// newCachingTokenSource obtains the token source of the client starting from the token "t" cached at "key" (empty if
+// not cached yet), which saves every new token into the token cache.
+func (app *App) newCachingTokenSource(ctx context.Context, client Client, key string, t *oauth2.Token) (oauth2.TokenSource, error) {
 	ts, err := client.ObtainTokenSource(ctx, t)
 	if err != nil {
 		return nil, err
@@ -81,8 +337,44 @@ func (app *App) obtainTokenSourceViaClient(ctx context.Context, client Client) (
 	if err != nil {
 		return nil, err
 	}
-	app.tokenCache.Set(client.ID(), newt)
-	return ts, nil
+	newKey, err := app.saveAccountToken(ctx, client, key, newt)
+	if err != nil {
+		return nil, err
+	}
+	return &cachingTokenSource{
+		app:  app,
+		key:  newKey,
+		base: ts,
+		last: newt,
+	}, nil
+}
+
+// saveAccountToken saves the token of the client keyed by its account, which replaces the token previously cached at
+// "oldKey" (if any), e.g. the token cached by the former versions whose account is unknown. The token cached at "oldKey"
+// for other scopes is only replaced if they are superseded by the scopes of the client.
+// Without login hint, the token of unknown account is replaced as well, as it would be ambiguous to select.
+// The ID token is not cached, hence the account of a token loaded from the cache is the one of "oldKey".
+// It returns the key where the token is saved.
+func (app *App) saveAccountToken(ctx context.Context, client Client, oldKey string, t *oauth2.Token) (string, error) {
+	account := tokenAccount(t)
+	if account == nil && oldKey != "" {
+		_, account = parseCacheKey(oldKey)
+	}
+	key := cacheKey(client.ID(), account)
+	if err := app.saveToken(ctx, key, t); err != nil {
+		return "", err
+	}
+	stale := func(id string) bool { return id != key && app.tokenCache.Get(id) != nil }
+	oldID, _ := parseCacheKey(oldKey)
+	removeOld := oldKey != "" && (oldID == client.ID() || supersedes(client.ID(), oldID)) && stale(oldKey)
+	removeUnknown := key != client.ID() && loginOptions(client).LoginHint == "" && stale(client.ID())
+	if !removeOld && !removeUnknown {
+		return key, nil
+	}
+	_, err := app.RemoveCacheEntries(ctx, func(entry CacheEntry) bool {
+		return (removeOld && entry.ID == oldKey) || (removeUnknown && entry.ID == client.ID())
+	})
+	return key, err
 }
 
 func NewApp() *App {
@@ -0,0 +1,341 @@
+package msauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/magodo/terraform-provider-outlook/msauth"
+	"golang.org/x/oauth2"
+)
+
+func writeCacheFile(t *testing.T, path string, cache map[string]*oauth2.Token) {
+	b, err := json.Marshal(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readCacheFile(t *testing.T, path string) map[string]*oauth2.Token {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cache map[string]*oauth2.Token
+	if err := json.Unmarshal(b, &cache); err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func TestExportCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.json")
+
+	writeCacheFile(t, path, map[string]*oauth2.Token{"a": {RefreshToken: "a1"}})
+	app := msauth.NewApp()
+	if err := app.SyncCache(context.Background(), msauth.NewFileTokenCacheStore(path)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process adds an entry meanwhile.
+	writeCacheFile(t, path, map[string]*oauth2.Token{"a": {RefreshToken: "a1"}, "b": {RefreshToken: "b1"}})
+
+	if err := app.ExportCache(path); err != nil {
+		t.Fatal(err)
+	}
+	cache := readCacheFile(t, path)
+	if len(cache) != 2 || cache["a"].RefreshToken != "a1" || cache["b"].RefreshToken != "b1" {
+		t.Fatalf("unexpected cache: %+v", cache)
+	}
+
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := fi.Mode().Perm(); perm != 0600 {
+			t.Fatalf("expect permission 0600, got %o", perm)
+		}
+	}
+
+	// Neither the lock file nor the temporary file is left over.
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expect only the cache file, got %d files", len(files))
+	}
+}
+
+func TestSyncCache_notExist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := msauth.NewApp().SyncCache(context.Background(), msauth.NewFileTokenCacheStore(filepath.Join(dir, "cache.json"))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncCache_encrypt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.json")
+
+	// The refresh token contains "-", which never appears in the base64 encoded ciphertext by chance.
+	const refreshToken = "secret-refresh-token"
+	writeCacheFile(t, path, map[string]*oauth2.Token{"a": {RefreshToken: refreshToken}})
+
+	// The plain token cache is encrypted on first use.
+	app := msauth.NewApp()
+	app.SetCachePassphrase("foo")
+	if err := app.SyncCache(context.Background(), msauth.NewFileTokenCacheStore(path)); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), refreshToken) {
+		t.Fatalf("token cache is not encrypted: %s", string(b))
+	}
+
+	// The encrypted token cache can only be imported with the correct passphrase.
+	if err := msauth.NewApp().ImportCache(path); err == nil {
+		t.Fatal("expect error importing encrypted token cache without passphrase")
+	}
+	app = msauth.NewApp()
+	app.SetCachePassphrase("bar")
+	if err := app.ImportCache(path); err == nil {
+		t.Fatal("expect error importing encrypted token cache with wrong passphrase")
+	}
+	app = msauth.NewApp()
+	app.SetCachePassphrase("foo")
+	if err := app.ImportCache(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Exporting keeps the token cache encrypted.
+	if err := app.ExportCache(path); err != nil {
+		t.Fatal(err)
+	}
+	b, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), refreshToken) {
+		t.Fatalf("token cache is not encrypted: %s", string(b))
+	}
+}
+
+func TestRemoveCacheEntries(t *testing.T) {
+	const (
+		idA = "client-a @ https://login.microsoftonline.com/common/oauth2/v2.0/token (mail.readwrite offline_access)"
+		idB = "client-b @ https://login.microsoftonline.com/common/oauth2/v2.0/token (mail.readwrite)"
+	)
+	store := msauth.NewMemoryTokenCacheStore()
+	if err := store.Update(context.Background(), func([]byte) ([]byte, error) {
+		return json.Marshal(map[string]*oauth2.Token{
+			idA: {AccessToken: "a", RefreshToken: "a1"},
+			idB: {AccessToken: "b"},
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	app := msauth.NewApp()
+	if err := app.SyncCache(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := app.CacheEntries()
+	if len(entries) != 2 {
+		t.Fatalf("expect 2 entries, got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.ID != idA || entry.ClientID != "client-a" || entry.TokenURL != "https://login.microsoftonline.com/common/oauth2/v2.0/token" ||
+		strings.Join(entry.Scopes, " ") != "mail.readwrite offline_access" || !entry.HasRefreshToken {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+
+	n, err := app.RemoveCacheEntries(context.Background(), func(entry msauth.CacheEntry) bool { return entry.ClientID == "client-a" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expect 1 entry removed, got %d", n)
+	}
+	if entries := app.CacheEntries(); len(entries) != 1 || entries[0].ID != idB {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	b, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cache map[string]*oauth2.Token
+	if err := json.Unmarshal(b, &cache); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache[idA]; ok || len(cache) != 1 {
+		t.Fatalf("unexpected stored cache: %+v", cache)
+	}
+}
+
+func TestApp_otherScopes(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("refresh_token") != "rt" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant", "error_description": "the refresh token is invalid"}`))
+			return
+		}
+		fmt.Fprintf(w, `{"access_token": "at %s", "token_type": "Bearer", "expires_in": 3600, "refresh_token": "rt"}`, r.PostForm.Get("scope"))
+	}))
+	defer tokenServer.Close()
+	authority := msauth.Authority{Host: tokenServer.URL, TenantID: "common"}
+	tokenURL := authority.Endpoint().TokenURL
+
+	cases := []struct {
+		name     string
+		cache    map[string]*oauth2.Token
+		scopes   []string
+		login    bool
+		remained []string
+	}{
+		{
+			name: "superseded",
+			cache: map[string]*oauth2.Token{
+				"client @ " + tokenURL + " (mail.readwrite offline_access)": {AccessToken: "old", RefreshToken: "rt"},
+			},
+			scopes: []string{"mail.readwrite", "offline_access", "user.read"},
+		},
+		{
+			name: "not superseded",
+			cache: map[string]*oauth2.Token{
+				"client @ " + tokenURL + " (mail.readwrite mailboxsettings.readwrite offline_access)": {AccessToken: "old", RefreshToken: "rt"},
+			},
+			scopes:   []string{"mail.read", "offline_access"},
+			remained: []string{"client @ " + tokenURL + " (mail.readwrite mailboxsettings.readwrite offline_access)"},
+		},
+		{
+			name: "other client",
+			cache: map[string]*oauth2.Token{
+				"other @ " + tokenURL + " (mail.readwrite offline_access)": {AccessToken: "old", RefreshToken: "rt"},
+			},
+			scopes:   []string{"mail.readwrite", "offline_access"},
+			login:    true,
+			remained: []string{"other @ " + tokenURL + " (mail.readwrite offline_access)"},
+		},
+		{
+			name: "refresh token revoked",
+			cache: map[string]*oauth2.Token{
+				"client @ " + tokenURL + " (mail.readwrite offline_access)": {AccessToken: "old", RefreshToken: "revoked"},
+			},
+			scopes:   []string{"mail.readwrite", "offline_access", "user.read"},
+			login:    true,
+			remained: []string{"client @ " + tokenURL + " (mail.readwrite offline_access)"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store := msauth.NewMemoryTokenCacheStore()
+			if err := store.Update(context.Background(), func([]byte) ([]byte, error) { return json.Marshal(c.cache) }); err != nil {
+				t.Fatal(err)
+			}
+			app := msauth.NewApp()
+			if err := app.SyncCache(context.Background(), store); err != nil {
+				t.Fatal(err)
+			}
+
+			var login bool
+			f := func(string) error {
+				login = true
+				return errors.New("login is not expected")
+			}
+			ts, err := app.ObtainTokenSourceViaAuthorizationCodeFlow(context.Background(), authority, "client", nil, "http://localhost", f, c.scopes...)
+			if login != c.login {
+				t.Fatalf("expect login %t, got %t", c.login, login)
+			}
+			if c.login {
+				if err == nil {
+					t.Fatal("expect error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := ts.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The OIDC scopes are requested additionally.
+			if expect := "at " + strings.Join(c.scopes, " ") + " openid profile"; token.AccessToken != expect {
+				t.Fatalf("expect access token %q, got %q", expect, token.AccessToken)
+			}
+
+			var ids []string
+			for _, entry := range app.CacheEntries() {
+				ids = append(ids, entry.ID)
+			}
+			sort.Strings(ids)
+			expect := append([]string{"client @ " + tokenURL + " (" + strings.ToLower(strings.Join(c.scopes, " ")) + ")"}, c.remained...)
+			sort.Strings(expect)
+			if strings.Join(ids, "\n") != strings.Join(expect, "\n") {
+				t.Fatalf("expect cache entries:\n%s\ngot:\n%s", strings.Join(expect, "\n"), strings.Join(ids, "\n"))
+			}
+		})
+	}
+}
+
+func TestApp_otherScopesOfAccounts(t *testing.T) {
+	authority := msauth.Authority{Host: "https://login.example.com", TenantID: "common"}
+	tokenURL := authority.Endpoint().TokenURL
+	store := msauth.NewMemoryTokenCacheStore()
+	if err := store.Update(context.Background(), func([]byte) ([]byte, error) {
+		return json.Marshal(map[string]*oauth2.Token{
+			"client @ " + tokenURL + " (mail.readwrite offline_access) # oid1.tid alice@contoso.com": {RefreshToken: "rt1"},
+			"client @ " + tokenURL + " (mail.readwrite offline_access) # oid2.tid bob@contoso.com":   {RefreshToken: "rt2"},
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	app := msauth.NewApp()
+	if err := app.SyncCache(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+
+	// The refresh tokens cached for other scopes are selected by account as well.
+	client := msauth.NewClientViaDeviceFlow(authority, "client", nil, "mail.readwrite", "offline_access", "user.read")
+	_, err := app.ObtainTokenSourceViaClient(context.Background(), client)
+	if err == nil || !strings.Contains(err.Error(), "alice@contoso.com, bob@contoso.com") {
+		t.Fatalf("expect the accounts to be ambiguous, got %v", err)
+	}
+}
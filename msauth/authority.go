@@ -0,0 +1,41 @@
+package msauth
+
+import (
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// Authority hosts of the Microsoft identity platform in the national clouds.
+// (See https://docs.microsoft.com/en-us/azure/active-directory/develop/authentication-national-cloud)
+const (
+	AuthorityHostPublic       = "https://login.microsoftonline.com"
+	AuthorityHostUSGovernment = "https://login.microsoftonline.us"
+	AuthorityHostChina        = "https://login.chinacloudapi.cn"
+)
+
+// Authority identifies where the oauth2 endpoints of a tenant are hosted.
+type Authority struct {
+	// Host is the base URL of the login service, e.g. AuthorityHostPublic.
+	Host string
+
+	// TenantID is either the tenant ID (or domain) or one of "common", "organizations" and "consumers".
+	TenantID string
+}
+
+func (a Authority) baseURL() string {
+	return strings.TrimSuffix(a.Host, "/") + "/" + a.TenantID + "/oauth2/v2.0"
+}
+
+// Endpoint returns the oauth2 endpoint of the authority.
+func (a Authority) Endpoint() oauth2.Endpoint {
+	return oauth2.Endpoint{
+		AuthURL:  a.baseURL() + "/authorize",
+		TokenURL: a.baseURL() + "/token",
+	}
+}
+
+// DeviceAuthorizationURL returns the device authorization endpoint of the authority.
+func (a Authority) DeviceAuthorizationURL() string {
+	return a.baseURL() + "/devicecode"
+}
@@ -0,0 +1,466 @@
+// Package authtest provides a fake Microsoft identity platform authorization server for the offline tests of msauth.
+package authtest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/magodo/terraform-provider-outlook/msauth"
+)
+
+const (
+	// DefaultTenantID is the tenant of the DefaultUser.
+	DefaultTenantID = "72f988bf-86f1-41af-91ab-2d7cd011db47"
+
+	clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// User is the account signing in to the Server.
+type User struct {
+	ObjectID string
+	TenantID string
+	Username string
+	Name     string
+}
+
+// DefaultUser is the user signing in to the Server, unless Server.User is set.
+var DefaultUser = User{
+	ObjectID: "6e2b4f8a-3c1d-4b8e-9f0a-5d7c2e1b3a49",
+	TenantID: DefaultTenantID,
+	Username: "john@contoso.com",
+	Name:     "John Doe",
+}
+
+// Server is a fake authorization server, which serves the oauth2 endpoints of any tenant at
+// "<URL>/<tenant>/oauth2/v2.0/{authorize,token,devicecode}", similar to the Microsoft identity platform.
+//
+// The authorize endpoint signs in the User immediately, and redirects to the redirect URI with the authorization
+// code. The device authorization is completed once the DeviceResponses are all returned. The issued tokens are
+// unsigned JWTs, whose claims are the ones decoded by msauth.
+//
+// The fields are meant to be set before the Server is used.
+type Server struct {
+	*httptest.Server
+
+	// User is the user signing in by the interactive flows.
+	User User
+
+	// Secrets are the client secrets of the confidential clients, keyed by the client ID. The other clients are public,
+	// except they can authenticate by any client assertion.
+	Secrets map[string]string
+
+	// Passwords are the passwords of the users who can sign in by the resource owner password credentials grant, keyed
+	// by the username. The User signs in if the username is the one of it, otherwise a user of the username signs in.
+	Passwords map[string]string
+
+	// Roles are the application permissions granted to the app-only tokens.
+	Roles []string
+
+	// TokenLifetime is the lifetime of the issued access tokens, which defaults to 1 hour.
+	TokenLifetime time.Duration
+
+	// AuthorizeError is the error redirected to the redirect URI by the authorize endpoint (e.g. "access_denied"),
+	// instead of the authorization code.
+	AuthorizeError string
+
+	// DeviceResponses are the errors returned in order by the token endpoint for the device code grant (e.g.
+	// "authorization_pending", "slow_down"). The token is issued afterwards, unless the last one is a final error
+	// (e.g. "expired_token", "authorization_declined").
+	DeviceResponses []string
+
+	// DeviceInterval is the polling interval of the device code grant, in seconds.
+	DeviceInterval int
+
+	mutex         sync.Mutex
+	codes         map[string]authorization
+	deviceCodes   map[string]authorization
+	refreshTokens map[string]authorization
+	tokenRequests []url.Values
+	seq           int
+}
+
+// authorization is the grant of a user to a client.
+type authorization struct {
+	clientID    string
+	redirectURI string
+	scopes      []string
+	challenge   string
+	user        User
+	// pending are the remaining error responses of the device code grant.
+	pending []string
+}
+
+// NewServer starts a Server. The caller should call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		User:          DefaultUser,
+		Secrets:       map[string]string{},
+		Passwords:     map[string]string{},
+		codes:         map[string]authorization{},
+		deviceCodes:   map[string]authorization{},
+		refreshTokens: map[string]authorization{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Authority returns the authority of the tenant hosted by the Server.
+func (s *Server) Authority(tenantID string) msauth.Authority {
+	return msauth.Authority{Host: s.URL, TenantID: tenantID}
+}
+
+// TokenRequests returns the forms of all the requests received by the token endpoint so far.
+func (s *Server) TokenRequests() []url.Values {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]url.Values{}, s.tokenRequests...)
+}
+
+// RevokeRefreshTokens invalidates all the issued refresh tokens, e.g. as the password of the user is changed.
+func (s *Server) RevokeRefreshTokens() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.refreshTokens = map[string]authorization{}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	// The path is in the form of "/<tenant>/oauth2/v2.0/<endpoint>".
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(segments) != 4 || segments[1] != "oauth2" || segments[2] != "v2.0" {
+		http.NotFound(w, r)
+		return
+	}
+	switch segments[3] {
+	case "authorize":
+		s.authorize(w, r)
+	case "devicecode":
+		s.deviceAuthorize(w, r)
+	case "token":
+		s.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// newID returns a unique opaque value, e.g. for the authorization codes.
+func (s *Server) newID(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s-%d-%d", prefix, s.seq, time.Now().UnixNano())
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		writeError(w, http.StatusBadRequest, msauth.TokenErrorInvalidRequest, "AADSTS50011: the redirect URI is invalid")
+		return
+	}
+	if query.Get("response_type") != "code" || query.Get("client_id") == "" {
+		writeError(w, http.StatusBadRequest, msauth.TokenErrorInvalidRequest, "AADSTS900144: the request body must contain response_type=code and client_id")
+		return
+	}
+	if m := query.Get("code_challenge_method"); query.Get("code_challenge") != "" && m != "S256" {
+		writeError(w, http.StatusBadRequest, msauth.TokenErrorInvalidRequest, "AADSTS501491: unsupported code_challenge_method "+m)
+		return
+	}
+
+	response := url.Values{}
+	if s.AuthorizeError != "" {
+		response.Set("error", s.AuthorizeError)
+		response.Set("error_description", "AADSTS65004: User declined to consent to access the app.")
+	} else {
+		s.mutex.Lock()
+		code := s.newID("code")
+		s.codes[code] = authorization{
+			clientID:    query.Get("client_id"),
+			redirectURI: redirectURI.String(),
+			scopes:      strings.Fields(query.Get("scope")),
+			challenge:   query.Get("code_challenge"),
+			user:        s.User,
+		}
+		s.mutex.Unlock()
+		response.Set("code", code)
+	}
+	if state := query.Get("state"); state != "" {
+		response.Set("state", state)
+	}
+	redirectURI.RawQuery = response.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *Server) deviceAuthorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, msauth.TokenErrorInvalidRequest, "AADSTS900561: the endpoint only accepts POST requests")
+		return
+	}
+	if r.PostForm.Get("client_id") == "" {
+		writeError(w, http.StatusBadRequest, msauth.TokenErrorInvalidRequest, "AADSTS900144: the request body must contain client_id")
+		return
+	}
+	s.mutex.Lock()
+	code := s.newID("device")
+	s.deviceCodes[code] = authorization{
+		clientID: r.PostForm.Get("client_id"),
+		scopes:   strings.Fields(r.PostForm.Get("scope")),
+		user:     s.User,
+		pending:  append([]string{}, s.DeviceResponses...),
+	}
+	s.mutex.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"device_code":      code,
+		"user_code":        "FAKE" + fmt.Sprint(len(code)),
+		"verification_uri": s.URL + "/devicelogin",
+		"expires_in":       900,
+		"interval":         s.DeviceInterval,
+		"message":          "To sign in, use a web browser to open the page " + s.URL + "/devicelogin to authenticate.",
+	})
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Method != http.MethodPost {
+		writeError(w, http.StatusBadRequest, msauth.TokenErrorInvalidRequest, "AADSTS900561: the endpoint only accepts POST requests")
+		return
+	}
+	form := r.PostForm
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tokenRequests = append(s.tokenRequests, form)
+
+	clientID := form.Get("client_id")
+	if clientID == "" {
+		writeError(w, http.StatusBadRequest, msauth.TokenErrorInvalidRequest, "AADSTS900144: the request body must contain client_id")
+		return
+	}
+	if form.Get("claims") != "" && !json.Valid([]byte(form.Get("claims"))) {
+		writeError(w, http.StatusBadRequest, msauth.TokenErrorInvalidRequest, "AADSTS90014: the claims parameter is not valid JSON")
+		return
+	}
+	confidential, err := s.authenticateClient(form)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, msauth.TokenErrorInvalidClient, err.Error())
+		return
+	}
+
+	switch grantType := form.Get("grant_type"); grantType {
+	case "authorization_code":
+		auth, ok := s.codes[form.Get("code")]
+		// The authorization code can only be redeemed once.
+		delete(s.codes, form.Get("code"))
+		switch {
+		case !ok || auth.clientID != clientID:
+			writeError(w, http.StatusBadRequest, msauth.TokenErrorInvalidGrant, "AADSTS70000: the provided authorization code is invalid or expired")
+		case auth.redirectURI != form.Get("redirect_uri"):
+			writeError(w, http.StatusBadRequest, msauth.TokenErrorInvalidGrant, "AADSTS50148: the redirect_uri mismatches the one of the authorization request")
+		case auth.challenge == "" && !confidential:
+			writeError(w, http.StatusBadRequest, msauth.TokenErrorInvalidClient, "AADSTS7000218: the request body must contain client_assertion or client_secret")
+		case auth.challenge != "" && pkceChallenge(form.Get("code_verifier")) != auth.challenge:
+			writeError(w, http.StatusBadRequest, msauth.TokenErrorInvalidGrant, "AADSTS501481: the code_verifier does not match the code_challenge")
+		default:
+			s.writeToken(w, auth)
+		}
+
+	case "refresh_token":
+		auth, ok := s.refreshTokens[form.Get("refresh_token")]
+		if !ok || auth.clientID != clientID {
+			writeError(w, http.StatusBadRequest, msauth.TokenErrorInvalidGrant, "AADSTS70008: the refresh token has expired or is revoked")
+			return
+		}
+		// The refresh token is rotated.
+		delete(s.refreshTokens, form.Get("refresh_token"))
+		if scopes := strings.Fields(form.Get("scope")); len(scopes) != 0 {
+			auth.scopes = scopes
+		}
+		s.writeToken(w, auth)
+
+	case "client_credentials":
+		scopes := strings.Fields(form.Get("scope"))
+		if !confidential {
+			writeError(w, http.StatusUnauthorized, msauth.TokenErrorInvalidClient, "AADSTS7000218: the request body must contain client_assertion or client_secret")
+			return
+		}
+		if len(scopes) != 1 || !strings.HasSuffix(scopes[0], "/.default") {
+			writeError(w, http.StatusBadRequest, msauth.TokenErrorInvalidScope, "AADSTS1002012: the scope of client credentials flow must be the resource identifier suffixed with /.default")
+			return
+		}
+		s.writeToken(w, authorization{clientID: clientID, scopes: scopes})
+
+	case "password":
+		username := form.Get("username")
+		password, ok := s.Passwords[username]
+		if !ok || form.Get("password") != password {
+			writeError(w, http.StatusBadRequest, msauth.TokenErrorInvalidGrant, "AADSTS50126: Error validating credentials due to invalid username or password.")
+			return
+		}
+		user := s.User
+		if !strings.EqualFold(username, user.Username) {
+			user = User{ObjectID: fmt.Sprintf("%x", sha256.Sum256([]byte(username)))[:32], TenantID: DefaultTenantID, Username: username}
+		}
+		s.writeToken(w, authorization{clientID: clientID, scopes: strings.Fields(form.Get("scope")), user: user})
+
+	case deviceCodeGrantType:
+		auth, ok := s.deviceCodes[form.Get("device_code")]
+		if !ok || auth.clientID != clientID {
+			writeError(w, http.StatusBadRequest, msauth.TokenErrorInvalidGrant, "AADSTS70000: the provided device code is invalid")
+			return
+		}
+		if len(auth.pending) != 0 {
+			e := auth.pending[0]
+			auth.pending = auth.pending[1:]
+			s.deviceCodes[form.Get("device_code")] = auth
+			switch e {
+			case msauth.TokenErrorAuthorizationPending, msauth.TokenErrorSlowDown:
+			default:
+				// The final errors end the device authorization.
+				delete(s.deviceCodes, form.Get("device_code"))
+			}
+			writeError(w, http.StatusBadRequest, e, deviceErrorDescriptions[e])
+			return
+		}
+		delete(s.deviceCodes, form.Get("device_code"))
+		s.writeToken(w, auth)
+
+	default:
+		writeError(w, http.StatusBadRequest, msauth.TokenErrorUnsupportedGrantType, fmt.Sprintf("AADSTS70003: the grant type %q is not supported", grantType))
+	}
+}
+
+var deviceErrorDescriptions = map[string]string{
+	msauth.TokenErrorAuthorizationPending:  "AADSTS70016: OAuth 2.0 device flow error. Authorization is pending. Continue polling.",
+	msauth.TokenErrorSlowDown:              "AADSTS70016: OAuth 2.0 device flow error. Slow down the polling.",
+	msauth.TokenErrorExpiredToken:          "AADSTS70020: The provided value for the input parameter 'device_code' is not valid. This device code has expired.",
+	msauth.TokenErrorAuthorizationDeclined: "AADSTS70017: The user declined the authorization.",
+}
+
+// authenticateClient authenticates the client by the client secret or the client assertion, and tells whether it is a
+// confidential client.
+func (s *Server) authenticateClient(form url.Values) (bool, error) {
+	clientID := form.Get("client_id")
+	secret, registered := s.Secrets[clientID]
+	switch {
+	case form.Get("client_secret") != "":
+		if !registered || form.Get("client_secret") != secret {
+			return false, fmt.Errorf("AADSTS7000215: invalid client secret is provided for %s", clientID)
+		}
+		return true, nil
+	case form.Get("client_assertion") != "":
+		if form.Get("client_assertion_type") != clientAssertionType {
+			return false, fmt.Errorf("AADSTS700023: the client_assertion_type must be %s", clientAssertionType)
+		}
+		return true, nil
+	case registered:
+		return false, fmt.Errorf("AADSTS7000218: the request body must contain client_assertion or client_secret for %s", clientID)
+	}
+	return false, nil
+}
+
+// writeToken issues a token for the authorization.
+func (s *Server) writeToken(w http.ResponseWriter, auth authorization) {
+	lifetime := s.TokenLifetime
+	if lifetime == 0 {
+		lifetime = time.Hour
+	}
+	now := time.Now()
+	claims := map[string]interface{}{
+		"aud": "https://graph.microsoft.com",
+		"iss": s.URL + "/" + DefaultTenantID + "/v2.0",
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": now.Add(lifetime).Unix(),
+		"tid": DefaultTenantID,
+		"oid": "b0a3c2d1-7e6f-4a5b-8c9d-0e1f2a3b4c5d",
+		// uti is the unique token identifier.
+		"uti": s.newID("uti"),
+	}
+
+	var resourceScopes []string
+	oidc := map[string]bool{}
+	for _, scope := range auth.scopes {
+		switch scope = strings.ToLower(scope); scope {
+		case "openid", "profile", "email", "offline_access":
+			oidc[scope] = true
+		default:
+			resourceScopes = append(resourceScopes, strings.TrimPrefix(scope, "https://graph.microsoft.com/"))
+		}
+	}
+
+	body := map[string]interface{}{
+		"token_type":     "Bearer",
+		"expires_in":     int(lifetime.Seconds()),
+		"ext_expires_in": int(lifetime.Seconds()),
+	}
+	if auth.user.ObjectID == "" {
+		// The app-only token has the application permissions as roles.
+		claims["roles"] = s.Roles
+		claims["appid"] = auth.clientID
+	} else {
+		claims["tid"] = auth.user.TenantID
+		claims["oid"] = auth.user.ObjectID
+		claims["upn"] = auth.user.Username
+		claims["name"] = auth.user.Name
+		claims["scp"] = strings.Join(resourceScopes, " ")
+		body["scope"] = strings.Join(resourceScopes, " ")
+		if oidc["offline_access"] {
+			rt := s.newID("refresh")
+			s.refreshTokens[rt] = auth
+			body["refresh_token"] = rt
+		}
+		if oidc["openid"] {
+			idClaims := map[string]interface{}{
+				"aud": auth.clientID,
+				"iss": claims["iss"],
+				"iat": now.Unix(),
+				"exp": now.Add(lifetime).Unix(),
+				"tid": auth.user.TenantID,
+				"oid": auth.user.ObjectID,
+				"sub": auth.user.ObjectID,
+			}
+			if oidc["profile"] {
+				idClaims["preferred_username"] = auth.user.Username
+				idClaims["name"] = auth.user.Name
+			}
+			body["id_token"] = unsignedJWT(idClaims)
+		}
+	}
+	body["access_token"] = unsignedJWT(claims)
+	writeJSON(w, http.StatusOK, body)
+}
+
+// unsignedJWT encodes the claims as an unsigned JWT.
+func unsignedJWT(claims map[string]interface{}) string {
+	b, _ := json.Marshal(claims)
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + enc.EncodeToString(b) + "."
+}
+
+// pkceChallenge derives the S256 code challenge from the code verifier.
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// writeError writes the error response, in the form of the Microsoft identity platform.
+func writeError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error":             code,
+		"error_description": description,
+		"timestamp":         time.Now().UTC().Format("2006-01-02 15:04:05Z"),
+		"trace_id":          "00000000-0000-0000-0000-000000000000",
+		"correlation_id":    "00000000-0000-0000-0000-000000000000",
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,125 @@
+package msauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const encryptedCacheFormat = "msauth-encrypted-v1"
+
+// encryptedCache is the on-disk format of an encrypted token cache. The plain token cache is sealed by AES-256-GCM,
+// whose key is derived from a passphrase by scrypt.
+type encryptedCache struct {
+	Format     string `json:"format"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// isEncryptedCache tells whether the serialized token cache is in the encrypted format.
+func isEncryptedCache(b []byte) bool {
+	var c encryptedCache
+	// A plain token cache fails to unmarshal into the struct, or results in an empty format.
+	if err := json.Unmarshal(b, &c); err != nil {
+		return false
+	}
+	return c.Format == encryptedCacheFormat
+}
+
+// cacheCipher encrypts and decrypts the token cache by a passphrase.
+type cacheCipher struct {
+	passphrase string
+
+	// The derived key is memorized along with its salt, as scrypt is expensive by design.
+	mutex sync.Mutex
+	salt  []byte
+	key   []byte
+}
+
+func (c *cacheCipher) deriveKey(salt []byte) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.key != nil && string(c.salt) == string(salt) {
+		return c.key, nil
+	}
+	key, err := scrypt.Key([]byte(c.passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	c.salt, c.key = salt, key
+	return key, nil
+}
+
+// currentSalt returns the salt of the memorized key, or a new random salt if there is none.
+func (c *cacheCipher) currentSalt() ([]byte, error) {
+	c.mutex.Lock()
+	salt := c.salt
+	c.mutex.Unlock()
+	if salt != nil {
+		return salt, nil
+	}
+	salt = make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+func (c *cacheCipher) aead(salt []byte) (cipher.AEAD, error) {
+	key, err := c.deriveKey(salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (c *cacheCipher) encrypt(plaintext []byte) ([]byte, error) {
+	salt, err := c.currentSalt()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := c.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(encryptedCache{
+		Format:     encryptedCacheFormat,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, []byte(encryptedCacheFormat)),
+	}, "", "  ")
+}
+
+func (c *cacheCipher) decrypt(b []byte) ([]byte, error) {
+	var ec encryptedCache
+	if err := json.Unmarshal(b, &ec); err != nil {
+		return nil, err
+	}
+	aead, err := c.aead(ec.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(ec.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce size")
+	}
+	plaintext, err := aead.Open(nil, ec.Nonce, ec.Ciphertext, []byte(encryptedCacheFormat))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting token cache (is the passphrase correct?): %w", err)
+	}
+	return plaintext, nil
+}
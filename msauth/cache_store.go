@@ -0,0 +1,226 @@
+package msauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenCacheStore persists the serialized token cache.
+type TokenCacheStore interface {
+	// Load returns the stored token cache, or nil if nothing has been stored yet.
+	Load(ctx context.Context) ([]byte, error)
+
+	// Update replaces the stored token cache with the one returned from "f", which is passed in the currently stored
+	// token cache (nil if nothing has been stored yet). Implementations should make this read-modify-write atomic
+	// among the processes sharing the store, if possible.
+	Update(ctx context.Context, f func(current []byte) ([]byte, error)) error
+}
+
+// FileTokenCacheStore stores the token cache in a local file. The file is written atomically with permission 0600,
+// under the protection of a cross-process lock.
+type FileTokenCacheStore struct {
+	Path string
+}
+
+func NewFileTokenCacheStore(path string) *FileTokenCacheStore {
+	return &FileTokenCacheStore{Path: path}
+}
+
+func (s *FileTokenCacheStore) Load(ctx context.Context) ([]byte, error) {
+	b, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *FileTokenCacheStore) Update(ctx context.Context, f func(current []byte) ([]byte, error)) error {
+	lock, err := lockFile(s.Path)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	current, err := s.Load(ctx)
+	if err != nil {
+		return err
+	}
+	b, err := f(current)
+	if err != nil {
+		return err
+	}
+	// Otherwise, the update of the process taking over the lock would be overwritten.
+	if err := lock.check(); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Path, b, 0600)
+}
+
+// EnvTokenCacheStore loads the token cache from an environment variable holding the base64 encoded token cache.
+// As the environment of the parent process can't be changed, the updates are only visible to the current process.
+type EnvTokenCacheStore struct {
+	Name string
+
+	mutex sync.Mutex
+}
+
+func NewEnvTokenCacheStore(name string) *EnvTokenCacheStore {
+	return &EnvTokenCacheStore{Name: name}
+}
+
+func (s *EnvTokenCacheStore) Load(ctx context.Context) ([]byte, error) {
+	v := os.Getenv(s.Name)
+	if v == "" {
+		return nil, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+	if err != nil {
+		return nil, fmt.Errorf("decoding environment variable %s: %w", s.Name, err)
+	}
+	return b, nil
+}
+
+func (s *EnvTokenCacheStore) Update(ctx context.Context, f func(current []byte) ([]byte, error)) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	current, err := s.Load(ctx)
+	if err != nil {
+		return err
+	}
+	b, err := f(current)
+	if err != nil {
+		return err
+	}
+	return os.Setenv(s.Name, base64.StdEncoding.EncodeToString(b))
+}
+
+// CommandTokenCacheStore delegates the storage of the token cache to an external helper command, similar to the git
+// credential helpers. The helper is invoked with the command line appended by an action argument:
+//
+// - "get": the helper writes the stored token cache (if any) to stdout.
+// - "store": the helper stores the token cache read from stdin.
+//
+// The helper is responsible for the concurrency control among the processes sharing it.
+type CommandTokenCacheStore struct {
+	Command []string
+
+	// Timeout is how long the helper is allowed to run, after which it is killed. If zero, DefaultCommandTimeout is used.
+	Timeout time.Duration
+}
+
+func NewCommandTokenCacheStore(command ...string) *CommandTokenCacheStore {
+	return &CommandTokenCacheStore{Command: command}
+}
+
+func (s *CommandTokenCacheStore) run(ctx context.Context, action string, stdin []byte) ([]byte, error) {
+	if len(s.Command) == 0 {
+		return nil, errors.New("token cache helper command is empty")
+	}
+	b, err := runCommand(ctx, s.Timeout, append(append([]string{}, s.Command...), action), stdin)
+	if err != nil {
+		return nil, fmt.Errorf("running token cache helper %q %s: %w", s.Command[0], action, err)
+	}
+	return b, nil
+}
+
+// DefaultCommandTimeout is the default timeout of the external commands, e.g. the token cache helper, so that a hung
+// command doesn't block the provider forever.
+const DefaultCommandTimeout = time.Minute
+
+// runCommand runs the command with the stdin, and returns its stdout. The command is killed once ctx is done or the
+// timeout (DefaultCommandTimeout if zero) expires. The error of a failed command includes its stderr.
+func runCommand(ctx context.Context, timeout time.Duration, command []string, stdin []byte) ([]byte, error) {
+	if timeout == 0 {
+		timeout = DefaultCommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return stdout.Bytes(), nil
+	case <-ctx.Done():
+		// The command is killed, while Wait doesn't return until its output is closed, which might be held open by the
+		// subprocesses of the command.
+		return nil, ctx.Err()
+	}
+}
+
+func (s *CommandTokenCacheStore) Load(ctx context.Context) ([]byte, error) {
+	b, err := s.run(ctx, "get", nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil, nil
+	}
+	return b, nil
+}
+
+func (s *CommandTokenCacheStore) Update(ctx context.Context, f func(current []byte) ([]byte, error)) error {
+	current, err := s.Load(ctx)
+	if err != nil {
+		return err
+	}
+	b, err := f(current)
+	if err != nil {
+		return err
+	}
+	_, err = s.run(ctx, "store", b)
+	return err
+}
+
+// MemoryTokenCacheStore keeps the token cache in memory only, which is lost once the process exits.
+type MemoryTokenCacheStore struct {
+	mutex sync.Mutex
+	data  []byte
+}
+
+func NewMemoryTokenCacheStore() *MemoryTokenCacheStore {
+	return &MemoryTokenCacheStore{}
+}
+
+func (s *MemoryTokenCacheStore) Load(ctx context.Context) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.data, nil
+}
+
+func (s *MemoryTokenCacheStore) Update(ctx context.Context, f func(current []byte) ([]byte, error)) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b, err := f(s.data)
+	if err != nil {
+		return err
+	}
+	s.data = b
+	return nil
+}
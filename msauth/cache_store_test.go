@@ -0,0 +1,219 @@
+package msauth_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magodo/terraform-provider-outlook/msauth"
+)
+
+func testTokenCacheStore(t *testing.T, store msauth.TokenCacheStore) {
+	b, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b != nil {
+		t.Fatalf("expect nothing stored, got %s", string(b))
+	}
+
+	if err := store.Update(context.Background(), func(current []byte) ([]byte, error) {
+		if current != nil {
+			t.Fatalf("expect nothing stored, got %s", string(current))
+		}
+		return []byte("foo"), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Update(context.Background(), func(current []byte) ([]byte, error) {
+		return append(current, []byte("bar")...), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = store.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "foobar" {
+		t.Fatalf("expect foobar stored, got %s", string(b))
+	}
+}
+
+func TestMemoryTokenCacheStore(t *testing.T) {
+	testTokenCacheStore(t, msauth.NewMemoryTokenCacheStore())
+}
+
+func TestEnvTokenCacheStore(t *testing.T) {
+	const name = "MSAUTH_TEST_TOKEN_CACHE"
+	os.Unsetenv(name)
+	defer os.Unsetenv(name)
+	testTokenCacheStore(t, msauth.NewEnvTokenCacheStore(name))
+	if v := os.Getenv(name); v != base64.StdEncoding.EncodeToString([]byte("foobar")) {
+		t.Fatalf("unexpected environment variable value: %s", v)
+	}
+}
+
+func TestFileTokenCacheStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	testTokenCacheStore(t, msauth.NewFileTokenCacheStore(filepath.Join(dir, "cache.json")))
+}
+
+func TestFileTokenCacheStore_staleLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.json")
+
+	// The lock file left over by a crashed process.
+	if err := ioutil.WriteFile(path+".lock", nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path+".lock", old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := msauth.NewFileTokenCacheStore(path).Update(context.Background(), func([]byte) ([]byte, error) { return []byte("foo"), nil }); err != nil {
+		t.Fatal(err)
+	}
+	// Neither the stale lock file nor the one moved aside is left over.
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expect only the cache file, got %d files", len(files))
+	}
+}
+
+func TestFileTokenCacheStore_lockTakenOver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.json")
+	store := msauth.NewFileTokenCacheStore(path)
+	if err := store.Update(context.Background(), func([]byte) ([]byte, error) { return []byte("foo"), nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process takes over the lock file, e.g. it judged the lock stale while this one was stuck.
+	err = store.Update(context.Background(), func([]byte) ([]byte, error) {
+		if err := ioutil.WriteFile(path+".lock", []byte("other"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return []byte("bar"), nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "taken over") {
+		t.Fatalf("expect the lock taken over error, got %v", err)
+	}
+	if b, err := store.Load(context.Background()); err != nil || string(b) != "foo" {
+		t.Fatalf("expect the cache file not written, got %q (%v)", b, err)
+	}
+	// The lock file of the other process is left alone.
+	if b, err := ioutil.ReadFile(path + ".lock"); err != nil || string(b) != "other" {
+		t.Fatalf("expect the lock file of the other process kept, got %q (%v)", b, err)
+	}
+}
+
+func TestCommandTokenCacheStore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the helper is a shell script")
+	}
+	dir, err := ioutil.TempDir("", "msauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := `case "$1" in
+get) cat "$0" 2>/dev/null || true ;;
+store) cat > "$0" ;;
+esac`
+	testTokenCacheStore(t, msauth.NewCommandTokenCacheStore("sh", "-c", script, filepath.Join(dir, "cache")))
+}
+
+func TestCommandTokenCacheStore_error(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the helper is a shell script")
+	}
+	ctx := context.Background()
+
+	// The stderr of the failed helper is reported.
+	store := msauth.NewCommandTokenCacheStore("sh", "-c", `echo "no keyring" >&2; exit 1`)
+	if _, err := store.Load(ctx); err == nil || !strings.Contains(err.Error(), "no keyring") {
+		t.Fatalf("expect the stderr of the helper reported, got %v", err)
+	}
+
+	// The hung helper is killed after the timeout.
+	store = msauth.NewCommandTokenCacheStore("sh", "-c", "sleep 10")
+	store.Timeout = 100 * time.Millisecond
+	start := time.Now()
+	if _, err := store.Load(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect the helper timed out, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("expect the helper killed after the timeout")
+	}
+
+	// The helper is killed once the context is done.
+	store.Timeout = 0
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := store.Update(ctx, func([]byte) ([]byte, error) { return nil, nil }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect the helper aborted by the context, got %v", err)
+	}
+}
+
+func TestSyncCache_store(t *testing.T) {
+	store := msauth.NewMemoryTokenCacheStore()
+	if err := store.Update(context.Background(), func([]byte) ([]byte, error) {
+		return []byte(`{"a": {"refresh_token": "a1"}}`), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	app := msauth.NewApp()
+	app.SetCachePassphrase("foo")
+	if err := app.SyncCache(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+
+	// The plain token cache in the store is encrypted on first use, which can be imported by the passphrase.
+	b, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "msauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.json")
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := msauth.NewApp().ImportCache(path); err == nil {
+		t.Fatal("expect error importing encrypted token cache without passphrase")
+	}
+	other := msauth.NewApp()
+	other.SetCachePassphrase("foo")
+	if err := other.ImportCache(path); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,152 @@
+package msauth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// clientCapabilities advertises that the client is capable of handling the claims challenges of Continuous Access
+// Evaluation (CAE), in which case the Microsoft identity platform issues long-lived tokens which are revoked in near
+// real time instead.
+// (See https://docs.microsoft.com/en-us/azure/active-directory/develop/app-resilience-continuous-access-evaluation)
+var clientCapabilities = []string{"CP1"}
+
+// ClaimsTokenSource is an oauth2.TokenSource which can additionally obtain a new token satisfying a claims challenge.
+type ClaimsTokenSource interface {
+	oauth2.TokenSource
+
+	// TokenWithClaims obtains a new token with the "claims" request parameter, regardless of the current token.
+	TokenWithClaims(claims string) (*oauth2.Token, error)
+}
+
+// addClaims sets the "claims" request parameter of the token request, which merges the claims challenge (if any)
+// with the client capabilities.
+func addClaims(body url.Values, challenge string) error {
+	claims := map[string]interface{}{}
+	if challenge != "" {
+		if err := json.Unmarshal([]byte(challenge), &claims); err != nil {
+			return fmt.Errorf("unmarshalling claims challenge: %w", err)
+		}
+	}
+	accessToken, ok := claims["access_token"].(map[string]interface{})
+	if !ok {
+		accessToken = map[string]interface{}{}
+		claims["access_token"] = accessToken
+	}
+	accessToken["xms_cc"] = map[string]interface{}{"values": clientCapabilities}
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	body.Set("claims", string(b))
+	return nil
+}
+
+// parseClaimsChallenge returns the decoded claims of the claims challenge in the WWW-Authenticate headers, e.g.:
+//
+//	Bearer realm="", authorization_uri="https://login.microsoftonline.com/common/oauth2/authorize", error="insufficient_claims", claims="eyJhY2Nlc3NfdG9rZW4iOnsibmJmIjp7ImVzc2VudGlhbCI6dHJ1ZSwgInZhbHVlIjoiMTYwNDEwNjY1MSJ9fX0="
+func parseClaimsChallenge(headers []string) (string, bool) {
+	for _, header := range headers {
+		scheme, params := parseAuthenticateHeader(header)
+		if !strings.EqualFold(scheme, "Bearer") || params["error"] != "insufficient_claims" || params["claims"] == "" {
+			continue
+		}
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+			if b, err := enc.DecodeString(params["claims"]); err == nil {
+				return string(b), true
+			}
+		}
+	}
+	return "", false
+}
+
+// parseAuthenticateHeader parses a WWW-Authenticate header with a single challenge into the scheme and the auth params.
+func parseAuthenticateHeader(header string) (string, map[string]string) {
+	header = strings.TrimSpace(header)
+	scheme := header
+	if i := strings.IndexByte(header, ' '); i != -1 {
+		scheme, header = header[:i], header[i+1:]
+	} else {
+		header = ""
+	}
+
+	params := map[string]string{}
+	for header != "" {
+		header = strings.TrimLeft(header, " ,")
+		i := strings.IndexByte(header, '=')
+		if i == -1 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(header[:i]))
+		header = strings.TrimLeft(header[i+1:], " ")
+
+		var value strings.Builder
+		if strings.HasPrefix(header, `"`) {
+			// quoted-string, with backslash escaping
+			j := 1
+			for ; j < len(header) && header[j] != '"'; j++ {
+				if header[j] == '\\' && j+1 < len(header) {
+					j++
+				}
+				value.WriteByte(header[j])
+			}
+			if j < len(header) {
+				j++
+			}
+			header = header[j:]
+		} else {
+			j := strings.IndexByte(header, ',')
+			if j == -1 {
+				j = len(header)
+			}
+			value.WriteString(strings.TrimSpace(header[:j]))
+			header = header[j:]
+		}
+		params[key] = value.String()
+	}
+	return scheme, params
+}
+
+// reuseTokenSource is similar to the one returned by oauth2.ReuseTokenSource, which reuses the token until it expires,
+// except it also forwards the claims challenges.
+type reuseTokenSource struct {
+	base ClaimsTokenSource
+
+	mutex sync.Mutex
+	t     *oauth2.Token
+}
+
+func newReuseTokenSource(t *oauth2.Token, base ClaimsTokenSource) *reuseTokenSource {
+	return &reuseTokenSource{base: base, t: t}
+}
+
+func (s *reuseTokenSource) Token() (*oauth2.Token, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.t.Valid() {
+		return s.t, nil
+	}
+	t, err := s.base.Token()
+	if err != nil {
+		return nil, err
+	}
+	s.t = t
+	return t, nil
+}
+
+func (s *reuseTokenSource) TokenWithClaims(claims string) (*oauth2.Token, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	t, err := s.base.TokenWithClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+	s.t = t
+	return t, nil
+}
@@ -0,0 +1,154 @@
+package msauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// Credential obtains a token source from a kind of credential. The ClientCredentialClient is a Credential.
+type Credential interface {
+	ObtainTokenSource(ctx context.Context) (oauth2.TokenSource, error)
+}
+
+// CredentialUnavailableError tells the credential is not available (e.g. it is not configured), in which case the
+// ChainedCredential tries the next one.
+type CredentialUnavailableError struct {
+	Reason string
+}
+
+func (e *CredentialUnavailableError) Error() string {
+	return e.Reason
+}
+
+// UnavailableCredential is a Credential which is never available for the reason, which is shown in the error of the
+// ChainedCredential.
+type UnavailableCredential string
+
+func (c UnavailableCredential) ObtainTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	return nil, &CredentialUnavailableError{Reason: string(c)}
+}
+
+// ChainedCredential tries the credentials in order, and obtains the token source from the first available one, similar
+// to the DefaultAzureCredential of the Azure SDK. A typical chain consists of (in order):
+//
+//   - The client credentials flow with a client secret or certificate, for CI
+//   - The client credentials flow with a federated token, for workload identity
+//   - The cached token (see App.NewCachedCredential)
+//   - The interactive login (see App.NewInteractiveCredential), for laptops
+//
+// The chain stops at the first credential which is available but fails (e.g. the client secret is wrong), rather than
+// falling back to the others silently.
+type ChainedCredential struct {
+	names       []string
+	credentials []Credential
+}
+
+func NewChainedCredential() *ChainedCredential {
+	return &ChainedCredential{}
+}
+
+// Append appends the credential to the chain, the name is used in logs and errors.
+func (c *ChainedCredential) Append(name string, credential Credential) *ChainedCredential {
+	c.names = append(c.names, name)
+	c.credentials = append(c.credentials, credential)
+	return c
+}
+
+func (c *ChainedCredential) ObtainTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	chainErr := &ChainedCredentialError{}
+	for i, credential := range c.credentials {
+		ts, err := credential.ObtainTokenSource(ctx)
+		if err == nil {
+			log.Printf("[INFO] authenticated by the %s credential", c.names[i])
+			return ts, nil
+		}
+		chainErr.Names = append(chainErr.Names, c.names[i])
+		chainErr.Errors = append(chainErr.Errors, err)
+		var unavailable *CredentialUnavailableError
+		if !errors.As(err, &unavailable) {
+			break
+		}
+		log.Printf("[DEBUG] the %s credential is unavailable: %v", c.names[i], err)
+	}
+	return nil, chainErr
+}
+
+// ChainedCredentialError collects the error of every credential tried by the ChainedCredential.
+type ChainedCredentialError struct {
+	Names  []string
+	Errors []error
+}
+
+func (e *ChainedCredentialError) Error() string {
+	if len(e.Errors) == 0 {
+		return "no credential is configured in the chain"
+	}
+	var msgs []string
+	for i, err := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("- %s: %v", e.Names[i], err))
+	}
+	last := e.Errors[len(e.Errors)-1]
+	var unavailable *CredentialUnavailableError
+	if errors.As(last, &unavailable) {
+		return "no credential is available:\n" + strings.Join(msgs, "\n")
+	}
+	return fmt.Sprintf("the %s credential failed:\n%s", e.Names[len(e.Names)-1], strings.Join(msgs, "\n"))
+}
+
+// Unwrap returns the error of the last tried credential.
+func (e *ChainedCredentialError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e.Errors[len(e.Errors)-1]
+}
+
+type cachedCredential struct {
+	app    *App
+	client Client
+}
+
+// NewCachedCredential returns a Credential which obtains the token source of the client from the token cached in the
+// App, without any interaction. It is unavailable if there is no cached token, or the token can't be refreshed.
+func (app *App) NewCachedCredential(client Client) Credential {
+	return &cachedCredential{app: app, client: client}
+}
+
+func (c *cachedCredential) ObtainTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	key, t, err := c.app.cachedToken(c.client)
+	if err != nil {
+		return nil, &CredentialUnavailableError{Reason: err.Error()}
+	}
+	if t == nil {
+		return nil, &CredentialUnavailableError{Reason: "no token is cached"}
+	}
+	ts, err := c.app.newCachingTokenSource(ctx, c.client, key, t)
+	if err != nil {
+		return nil, &CredentialUnavailableError{Reason: fmt.Sprintf("refreshing the cached token: %v", err)}
+	}
+	return ts, nil
+}
+
+type interactiveCredential struct {
+	app    *App
+	client Client
+}
+
+// NewInteractiveCredential returns a Credential which logs in via the client regardless of the cached token, and saves
+// the token into the token cache of the App.
+func (app *App) NewInteractiveCredential(client Client) Credential {
+	return &interactiveCredential{app: app, client: client}
+}
+
+func (c *interactiveCredential) ObtainTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	t, err := c.app.login(ctx, c.client)
+	if err != nil {
+		return nil, err
+	}
+	return c.app.newCachingTokenSource(ctx, c.client, "", t)
+}
@@ -0,0 +1,110 @@
+package msauth_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/magodo/terraform-provider-outlook/msauth"
+	"golang.org/x/oauth2"
+)
+
+// stubCredential obtains a static token source with the access token, or fails with the error.
+type stubCredential struct {
+	accessToken string
+	err         error
+	called      bool
+}
+
+func (c *stubCredential) ObtainTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	c.called = true
+	if c.err != nil {
+		return nil, c.err
+	}
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: c.accessToken}), nil
+}
+
+func TestChainedCredential(t *testing.T) {
+	failed := &stubCredential{err: errors.New("invalid_client: the secret is wrong")}
+	succeeded := &stubCredential{accessToken: "at"}
+	notTried := &stubCredential{accessToken: "other"}
+
+	cases := []struct {
+		name  string
+		chain *msauth.ChainedCredential
+		token string
+		err   []string
+	}{
+		{
+			name: "fall back to the available credential",
+			chain: msauth.NewChainedCredential().
+				Append("secret", msauth.UnavailableCredential("no secret")).
+				Append("interactive", succeeded).
+				Append("other", notTried),
+			token: "at",
+		},
+		{
+			name: "stop at the failed credential",
+			chain: msauth.NewChainedCredential().
+				Append("cached", msauth.UnavailableCredential("no token is cached")).
+				Append("secret", failed).
+				Append("other", notTried),
+			err: []string{"the secret credential failed", "- cached: no token is cached", "- secret: invalid_client: the secret is wrong"},
+		},
+		{
+			name: "no credential available",
+			chain: msauth.NewChainedCredential().
+				Append("secret", msauth.UnavailableCredential("no secret")).
+				Append("interactive", msauth.UnavailableCredential("no terminal")),
+			err: []string{"no credential is available", "- secret: no secret", "- interactive: no terminal"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			notTried.called = false
+			ts, err := c.chain.ObtainTokenSource(context.Background())
+			if notTried.called {
+				t.Fatal("expect the chain to stop before the last credential")
+			}
+			if len(c.err) != 0 {
+				if err == nil {
+					t.Fatal("expect error")
+				}
+				for _, msg := range c.err {
+					if !strings.Contains(err.Error(), msg) {
+						t.Fatalf("expect error containing %q, got %v", msg, err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := ts.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.AccessToken != c.token {
+				t.Fatalf("expect access token %s, got %s", c.token, token.AccessToken)
+			}
+		})
+	}
+
+	// The error of the failed credential is kept.
+	_, err := msauth.NewChainedCredential().Append("secret", failed).ObtainTokenSource(context.Background())
+	if !errors.Is(err, failed.err) {
+		t.Fatalf("expect the error of the failed credential, got %v", err)
+	}
+}
+
+func TestCachedCredential_noCache(t *testing.T) {
+	authority := msauth.Authority{Host: msauth.AuthorityHostPublic, TenantID: "common"}
+	client := msauth.NewClientViaDeviceFlow(authority, "client", nil, "mail.read")
+	_, err := msauth.NewApp().NewCachedCredential(client).ObtainTokenSource(context.Background())
+	var unavailable *msauth.CredentialUnavailableError
+	if !errors.As(err, &unavailable) {
+		t.Fatalf("expect the credential to be unavailable, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package msauth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrNoIDToken is returned by IDTokenClaims if the token response contains no ID token, which is only issued if
+// the "openid" scope is requested.
+var ErrNoIDToken = errors.New("no ID token")
+
+// Claims are the claims of an ID token or an access token issued by the Microsoft identity platform, which identify the
+// account and the permissions.
+// (See https://docs.microsoft.com/en-us/azure/active-directory/develop/access-tokens#payload-claims)
+type Claims struct {
+	// ObjectID is the object ID of the account in the tenant.
+	ObjectID string `json:"oid"`
+	TenantID string `json:"tid"`
+	// UPN is the user principal name, which is absent for personal Microsoft accounts and app-only tokens.
+	UPN               string `json:"upn"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+	// Scope is the space separated delegated permissions granted to the client.
+	Scope string `json:"scp"`
+	// Roles are the application permissions granted to the client, in case of app-only tokens.
+	Roles []string `json:"roles"`
+}
+
+// Username returns the UPN, or the preferred username if UPN is absent.
+func (c Claims) Username() string {
+	if c.UPN != "" {
+		return c.UPN
+	}
+	return c.PreferredUsername
+}
+
+// Permissions returns the delegated permissions granted to the client, or the application permissions in case of
+// app-only tokens. The roles of a delegated token are the app roles assigned to the user, rather than the permissions of
+// the client.
+func (c Claims) Permissions() []string {
+	if c.Scope != "" {
+		return strings.Fields(c.Scope)
+	}
+	return c.Roles
+}
+
+// MissingPermissions returns the permissions in "permissions" which are not granted, ignoring the case.
+// A permission is also regarded as granted by its broader variants, e.g. "Mail.Read" by "Mail.ReadWrite", and
+// "User.Read" by the application permission "User.Read.All".
+func (c Claims) MissingPermissions(permissions ...string) []string {
+	granted := map[string]bool{}
+	for _, p := range c.Permissions() {
+		granted[strings.ToLower(p)] = true
+	}
+	var missing []string
+	for _, p := range permissions {
+		lp := strings.ToLower(p)
+		if !granted[lp] && !granted[lp+".all"] && !(strings.HasSuffix(lp, ".read") && (granted[lp+"write"] || granted[lp+"write.all"])) {
+			missing = append(missing, p)
+		}
+	}
+	return missing
+}
+
+// ParseClaims decodes the claims of the JWT without verifying its signature, as the token is received from the
+// token endpoint directly.
+func ParseClaims(token string) (*Claims, error) {
+	segments := strings.Split(token, ".")
+	// The access token of personal Microsoft accounts is opaque (e.g. encrypted), rather than a JWS.
+	if len(segments) != 3 {
+		return nil, errors.New("the token is not a JWT")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segments[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("decoding JWT payload: %w", err)
+	}
+	var claims Claims
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return nil, fmt.Errorf("unmarshalling JWT claims: %w", err)
+	}
+	return &claims, nil
+}
+
+// AccessTokenClaims decodes the claims of the access token.
+func AccessTokenClaims(t *oauth2.Token) (*Claims, error) {
+	return ParseClaims(t.AccessToken)
+}
+
+// IDTokenClaims decodes the claims of the ID token in the token response. It returns ErrNoIDToken if there is no ID token.
+func IDTokenClaims(t *oauth2.Token) (*Claims, error) {
+	idToken, _ := t.Extra("id_token").(string)
+	if idToken == "" {
+		return nil, ErrNoIDToken
+	}
+	return ParseClaims(idToken)
+}
@@ -0,0 +1,74 @@
+package msauth_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/magodo/terraform-provider-outlook/msauth"
+	"golang.org/x/oauth2"
+)
+
+// newTestJWT builds an unsigned JWT with the claims.
+func newTestJWT(t *testing.T, claims map[string]interface{}) string {
+	b, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + enc.EncodeToString(b) + "." + enc.EncodeToString([]byte("sig"))
+}
+
+func TestParseClaims(t *testing.T) {
+	token := newTestJWT(t, map[string]interface{}{
+		"oid": "00000000-0000-0000-0000-000000000001",
+		"tid": "00000000-0000-0000-0000-000000000002",
+		"upn": "john@contoso.com",
+		"scp": "Mail.ReadWrite MailboxSettings.ReadWrite User.Read",
+	})
+	claims, err := msauth.AccessTokenClaims(&oauth2.Token{AccessToken: token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.ObjectID != "00000000-0000-0000-0000-000000000001" || claims.TenantID != "00000000-0000-0000-0000-000000000002" || claims.Username() != "john@contoso.com" {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+	if missing := claims.MissingPermissions("mail.readwrite", "Mail.Read", "Calendars.Read", "MailboxSettings.ReadWrite.Shared"); !reflect.DeepEqual(missing, []string{"Calendars.Read", "MailboxSettings.ReadWrite.Shared"}) {
+		t.Fatalf("unexpected missing permissions: %v", missing)
+	}
+
+	// The app roles assigned to the user are not the permissions of the client.
+	claims.Roles = []string{"Calendars.Read"}
+	if missing := claims.MissingPermissions("Mail.ReadWrite", "Calendars.Read"); !reflect.DeepEqual(missing, []string{"Calendars.Read"}) {
+		t.Fatalf("unexpected missing permissions: %v", missing)
+	}
+	// The roles are the permissions of app-only tokens.
+	claims.Scope = ""
+	if missing := claims.MissingPermissions("Mail.ReadWrite", "Calendars.Read"); !reflect.DeepEqual(missing, []string{"Mail.ReadWrite"}) {
+		t.Fatalf("unexpected missing permissions: %v", missing)
+	}
+
+	if _, err := msauth.ParseClaims("EwBwA8l6BAAU.opaque"); err == nil {
+		t.Fatal("expect error for opaque token")
+	}
+}
+
+func TestIDTokenClaims(t *testing.T) {
+	if _, err := msauth.IDTokenClaims(&oauth2.Token{AccessToken: "foo"}); err != msauth.ErrNoIDToken {
+		t.Fatalf("expect ErrNoIDToken, got %v", err)
+	}
+	token := (&oauth2.Token{AccessToken: "foo"}).WithExtra(map[string]interface{}{
+		"id_token": newTestJWT(t, map[string]interface{}{"preferred_username": "john@outlook.com", "roles": []string{"Mail.ReadWrite", "User.ReadBasic.All"}}),
+	})
+	claims, err := msauth.IDTokenClaims(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Username() != "john@outlook.com" {
+		t.Fatalf("unexpected username: %s", claims.Username())
+	}
+	if missing := claims.MissingPermissions("Mail.ReadWrite", "Mail.Read", "User.Read"); !reflect.DeepEqual(missing, []string{"User.Read"}) {
+		t.Fatalf("unexpected missing permissions: %v", missing)
+	}
+}
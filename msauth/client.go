@@ -9,9 +9,54 @@ import (
 	"golang.org/x/oauth2"
 )
 
+// clientIdentifier identifies the client by the client ID, the token URL and the set of scopes, which are case
+// insensitive and unordered. Tokens of different scope sets are cached apart.
 func clientIdentifier(clientID, tokenURL string, scopes []string) string {
-	sort.Strings(scopes)
-	return fmt.Sprintf("%s @ %s (%s)", clientID, tokenURL, strings.Join(scopes, " "))
+	set := map[string]bool{}
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.ToLower(scope)
+		if !set[scope] {
+			set[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	sort.Strings(normalized)
+	return fmt.Sprintf("%s @ %s (%s)", clientID, tokenURL, strings.Join(normalized, " "))
+}
+
+// parseClientIdentifier parses the identifier built by clientIdentifier.
+func parseClientIdentifier(id string) (clientID, tokenURL string, scopes []string, ok bool) {
+	i := strings.Index(id, " @ ")
+	j := strings.LastIndex(id, " (")
+	if i == -1 || j < i || !strings.HasSuffix(id, ")") {
+		return "", "", nil, false
+	}
+	return id[:i], id[i+len(" @ ") : j], strings.Fields(id[j+len(" (") : len(id)-1]), true
+}
+
+// scopesCover tells whether the scopes cover the requested scopes, ignoring the case. A scope is also covered by its
+// broader variant, e.g. "Mail.Read" by "Mail.ReadWrite".
+func scopesCover(scopes, requested []string) bool {
+	set := map[string]bool{}
+	for _, scope := range scopes {
+		set[strings.ToLower(scope)] = true
+	}
+	for _, scope := range requested {
+		scope = strings.ToLower(scope)
+		if !set[scope] && !(strings.HasSuffix(scope, ".read") && set[scope+"write"]) {
+			return false
+		}
+	}
+	return true
+}
+
+// supersedes tells whether the client identified by "id" supersedes the one identified by "other", i.e. they share the
+// client ID and the token URL, while the scopes of the former cover the ones of the latter.
+func supersedes(id, other string) bool {
+	clientID, tokenURL, scopes, ok := parseClientIdentifier(id)
+	otherClientID, otherTokenURL, otherScopes, otherOK := parseClientIdentifier(other)
+	return ok && otherOK && clientID == otherClientID && tokenURL == otherTokenURL && scopesCover(scopes, otherScopes)
 }
 
 type Client interface {
@@ -0,0 +1,189 @@
+package msauth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"time"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// ClientCertificate authenticates the client by a JWT client assertion signed with the private key of
+// a certificate registered for the application.
+// (See https://docs.microsoft.com/en-us/azure/active-directory/develop/active-directory-certificate-credentials)
+type ClientCertificate struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+// NewClientCertificate parses a PEM (certificate and private key) or PFX (PKCS#12) encoded certificate.
+// The password is used to decrypt the PFX or an encrypted PEM private key, it can be empty otherwise.
+func NewClientCertificate(data []byte, password string) (*ClientCertificate, error) {
+	var blocks []*pem.Block
+	if rest := data; isPEM(rest) {
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			blocks = append(blocks, block)
+		}
+	} else {
+		var err error
+		blocks, err = pkcs12.ToPEM(data, password)
+		if err != nil {
+			return nil, fmt.Errorf("decoding PFX: %w", err)
+		}
+	}
+
+	var (
+		certs []*x509.Certificate
+		key   *rsa.PrivateKey
+	)
+	for _, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("parsing certificate: %w", err)
+			}
+			certs = append(certs, cert)
+		case "PRIVATE KEY", "RSA PRIVATE KEY":
+			if key != nil {
+				return nil, errors.New("more than one private key found")
+			}
+			b := block.Bytes
+			// Legacy encrypted PEM blocks are still produced by e.g. "openssl rsa -des3".
+			if x509.IsEncryptedPEMBlock(block) { //nolint:staticcheck
+				var err error
+				b, err = x509.DecryptPEMBlock(block, []byte(password)) //nolint:staticcheck
+				if err != nil {
+					return nil, fmt.Errorf("decrypting private key: %w", err)
+				}
+			}
+			var err error
+			key, err = parseRSAPrivateKey(b)
+			if err != nil {
+				return nil, err
+			}
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, errors.New("encrypted PKCS#8 private key is not supported, please use a PFX file instead")
+		}
+	}
+	if key == nil {
+		return nil, errors.New("no private key found")
+	}
+
+	// Pick up the certificate that pairs with the private key, in case a chain is included.
+	for _, cert := range certs {
+		if pub, ok := cert.PublicKey.(*rsa.PublicKey); ok && pub.N.Cmp(key.N) == 0 && pub.E == key.E {
+			return &ClientCertificate{cert: cert, key: key}, nil
+		}
+	}
+	return nil, errors.New("no certificate matches the private key")
+}
+
+// NewClientCertificateFromFile is similar to NewClientCertificate, except it reads the certificate from a file.
+func NewClientCertificateFromFile(path, password string) (*ClientCertificate, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := NewClientCertificate(b, password)
+	if err != nil {
+		return nil, fmt.Errorf("loading client certificate from %s: %w", path, err)
+	}
+	return cert, nil
+}
+
+// Thumbprint returns the hex encoded SHA-1 thumbprint of the certificate, as shown in the Azure Portal.
+func (c *ClientCertificate) Thumbprint() string {
+	sum := sha1.Sum(c.cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *ClientCertificate) TokenRequestParams(clientID, tokenURL string) (url.Values, error) {
+	assertion, err := c.assertion(clientID, tokenURL)
+	if err != nil {
+		return nil, err
+	}
+	return url.Values{
+		"client_assertion_type": {clientAssertionType},
+		"client_assertion":      {assertion},
+	}, nil
+}
+
+// assertion builds a signed JWT client assertion as defined in https://tools.ietf.org/html/rfc7523#section-2.2.
+func (c *ClientCertificate) assertion(clientID, tokenURL string) (string, error) {
+	thumbprint := sha1.Sum(c.cert.Raw)
+	header := map[string]interface{}{
+		"alg": "RS256",
+		"typ": "JWT",
+		"x5t": base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+	}
+	jti, err := randHex(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := map[string]interface{}{
+		"aud": tokenURL,
+		"iss": clientID,
+		"sub": clientID,
+		"jti": jti,
+		"nbf": now.Unix(),
+		"iat": now.Unix(),
+		"exp": now.Add(10 * time.Minute).Unix(),
+	}
+
+	hb, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	cb, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(hb) + "." + base64.RawURLEncoding.EncodeToString(cb)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, c.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("signing client assertion: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func isPEM(data []byte) bool {
+	block, _ := pem.Decode(data)
+	return block != nil
+}
+
+func parseRSAPrivateKey(b []byte) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(b); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T, only RSA key is supported", key)
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,122 @@
+package msauth_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magodo/terraform-provider-outlook/msauth"
+)
+
+func newTestCertificate(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "msauth test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+func TestClientCertificate_TokenRequestParams(t *testing.T) {
+	key, cert := newTestCertificate(t)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string][]byte{
+		"pkcs1": append(
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+			pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})...),
+		"pkcs8 key first": append(
+			pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...),
+	}
+
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			c, err := msauth.NewClientCertificate(data, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			params, err := c.TokenRequestParams("client", "https://login/token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v := params.Get("client_assertion_type"); v != "urn:ietf:params:oauth:client-assertion-type:jwt-bearer" {
+				t.Fatalf("unexpected client_assertion_type: %s", v)
+			}
+			parts := strings.Split(params.Get("client_assertion"), ".")
+			if len(parts) != 3 {
+				t.Fatalf("malformed assertion: %s", params.Get("client_assertion"))
+			}
+
+			var header map[string]string
+			decodeSegment(t, parts[0], &header)
+			thumbprint := sha1.Sum(cert.Raw)
+			if header["alg"] != "RS256" || header["x5t"] != base64.RawURLEncoding.EncodeToString(thumbprint[:]) {
+				t.Fatalf("unexpected header: %v", header)
+			}
+
+			var claims map[string]interface{}
+			decodeSegment(t, parts[1], &claims)
+			if claims["aud"] != "https://login/token" || claims["iss"] != "client" || claims["sub"] != "client" {
+				t.Fatalf("unexpected claims: %v", claims)
+			}
+
+			sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+			if err != nil {
+				t.Fatal(err)
+			}
+			digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+				t.Fatalf("verifying signature: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewClientCertificate_mismatchedKey(t *testing.T) {
+	_, cert := newTestCertificate(t)
+	otherKey, _ := newTestCertificate(t)
+	data := append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(otherKey)})...)
+	if _, err := msauth.NewClientCertificate(data, ""); err == nil {
+		t.Fatal("expect error for mismatched private key")
+	}
+}
+
+func decodeSegment(t *testing.T, seg string, v interface{}) {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		t.Fatal(err)
+	}
+}
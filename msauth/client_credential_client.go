@@ -2,9 +2,11 @@ package msauth
 
 import (
 	"context"
-	"golang.org/x/oauth2/clientcredentials"
-	"golang.org/x/oauth2/microsoft"
+	"fmt"
+	"net/url"
+	"strings"
 
+	"github.com/hashicorp/go-retryablehttp"
 	"golang.org/x/oauth2"
 )
 
@@ -14,30 +16,73 @@ type ClientCredentialClient interface {
 }
 
 type clientCredentialClient struct {
-	config *clientcredentials.Config
+	client     *HTTPClient
+	config     *oauth2.Config
+	credential ClientCredential
 }
 
 func (c *clientCredentialClient) ObtainTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
-	var err error
-	ts := c.config.TokenSource(ctx)
-	_, err = ts.Token()
+	t, err := c.token(ctx, "")
 	if err != nil {
 		return nil, err
 	}
-	return ts, nil
+	return newReuseTokenSource(t, &clientCredentialTokenSource{c}), nil
+}
+
+func (c *clientCredentialClient) token(ctx context.Context, claims string) (*oauth2.Token, error) {
+	body := url.Values{
+		"grant_type": {"client_credentials"},
+		"client_id":  {c.config.ClientID},
+		"scope":      {strings.Join(c.config.Scopes, " ")},
+	}
+	if err := addClientCredential(body, c.credential, c.config.ClientID, c.config.Endpoint.TokenURL); err != nil {
+		return nil, err
+	}
+	if err := addClaims(body, claims); err != nil {
+		return nil, err
+	}
+	req, err := NewFormRequestWithContext(ctx, c.config.Endpoint.TokenURL, body)
+	if err != nil {
+		return nil, err
+	}
+	token, tokenerr, err := c.client.DoToken(req)
+	if err != nil {
+		return nil, err
+	}
+	if tokenerr != nil {
+		return nil, fmt.Errorf("access token response: %s", tokenerr.String())
+	}
+	return token.ToOauth2Token(), nil
+}
+
+// clientCredentialTokenSource requests a new token every time it is called, as there is no refresh token
+// in the client credentials flow.
+type clientCredentialTokenSource struct {
+	c *clientCredentialClient
+}
+
+func (s *clientCredentialTokenSource) Token() (*oauth2.Token, error) {
+	// The token source outlives the context used to obtain it, hence it uses its own context.
+	return s.c.token(context.Background(), "")
+}
+
+func (s *clientCredentialTokenSource) TokenWithClaims(claims string) (*oauth2.Token, error) {
+	return s.c.token(context.Background(), claims)
 }
 
 // NOTE: The value passed for the scope parameter in this request should be the resource identifier (Application ID URI)
 //       of the resource you want, affixed with the .default suffix
 // 		(See https://docs.microsoft.com/en-us/graph/auth-v2-service#token-request for more details)
-func NewClientCredentialClient(tenantID string, clientID, clientCredential string, scopes ...string) ClientCredentialClient {
+func NewClientCredentialClient(authority Authority, clientID string, credential ClientCredential, scopes ...string) ClientCredentialClient {
+	client := retryablehttp.NewClient()
+	client.Logger = nil
 	return &clientCredentialClient{
-		config: &clientcredentials.Config{
-			ClientID:     clientID,
-			ClientSecret: clientCredential,
-			TokenURL:     microsoft.AzureADEndpoint(tenantID).TokenURL,
-			Scopes:       scopes,
-			AuthStyle:    oauth2.AuthStyleInParams,
+		client: NewHTTPClient(client),
+		config: &oauth2.Config{
+			ClientID: clientID,
+			Endpoint: authority.Endpoint(),
+			Scopes:   scopes,
 		},
+		credential: credential,
 	}
 }
@@ -2,18 +2,101 @@ package msauth_test
 
 import (
 	"context"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/magodo/terraform-provider-outlook/msauth"
+	"github.com/magodo/terraform-provider-outlook/msauth/authtest"
 )
 
 func TestObtainTokenViaClientCredentials(t *testing.T) {
 	t.Skip("Skipping as the msgraph tutorial app is disabled")
 	clientID := "6731de76-14a6-49ae-97bc-6eba6914391e" // msgraph tutorial client id
 	clientCredential := `JqQX2PNo9bpM0uEihUPzyrh`
-	c := msauth.NewClientCredentialClient("common", clientID, clientCredential, "https://graph.microsoft.com/.default")
+	c := msauth.NewClientCredentialClient(msauth.Authority{Host: msauth.AuthorityHostPublic, TenantID: "common"}, clientID, msauth.ClientSecret(clientCredential), "https://graph.microsoft.com/.default")
 	_, err := c.ObtainTokenSource(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
 }
+
+func TestObtainTokenViaClientCredentials_offline(t *testing.T) {
+	server := authtest.NewServer()
+	defer server.Close()
+	server.Secrets["client"] = "secret"
+	server.Roles = []string{"Mail.ReadWrite", "MailboxSettings.ReadWrite"}
+	os.Setenv("MSAUTH_TEST_FEDERATED_TOKEN", "federated-token")
+	defer os.Unsetenv("MSAUTH_TEST_FEDERATED_TOKEN")
+
+	cases := []struct {
+		name       string
+		clientID   string
+		credential msauth.ClientCredential
+		scope      string
+		err        string
+	}{
+		{
+			name:       "client secret",
+			clientID:   "client",
+			credential: msauth.ClientSecret("secret"),
+			scope:      "https://graph.microsoft.com/.default",
+		},
+		{
+			name:       "federated token",
+			clientID:   "workload",
+			credential: msauth.NewFederatedTokenFromEnv("MSAUTH_TEST_FEDERATED_TOKEN"),
+			scope:      "https://graph.microsoft.com/.default",
+		},
+		{
+			name:       "wrong client secret",
+			clientID:   "client",
+			credential: msauth.ClientSecret("wrong"),
+			scope:      "https://graph.microsoft.com/.default",
+			err:        "AADSTS7000215",
+		},
+		{
+			name:     "public client",
+			clientID: "public",
+			scope:    "https://graph.microsoft.com/.default",
+			err:      "AADSTS7000218",
+		},
+		{
+			name:       "delegated scope",
+			clientID:   "client",
+			credential: msauth.ClientSecret("secret"),
+			scope:      "Mail.Read",
+			err:        "invalid_scope",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := msauth.NewClientCredentialClient(server.Authority(authtest.DefaultTenantID), c.clientID, c.credential, c.scope)
+			ts, err := client.ObtainTokenSource(context.Background())
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expect error containing %q, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := ts.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := msauth.AccessTokenClaims(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if missing := claims.MissingPermissions("Mail.ReadWrite", "MailboxSettings.ReadWrite"); len(missing) != 0 {
+				t.Fatalf("expect the app roles granted, missing %v", missing)
+			}
+			if token.RefreshToken != "" {
+				t.Fatal("expect no refresh token for the client credentials flow")
+			}
+		})
+	}
+}
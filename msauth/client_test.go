@@ -1,5 +1,29 @@
 package msauth_test
 
+import (
+	"reflect"
+	"testing"
+
+	"github.com/magodo/terraform-provider-outlook/msauth"
+)
+
 const (
 	EnvvarInteractive string = "MSAUTH_INTERACTIVE"
 )
+
+func TestClientID(t *testing.T) {
+	authority := msauth.Authority{Host: msauth.AuthorityHostPublic, TenantID: "common"}
+	scopes := []string{"offline_access", "Mail.Read", "mail.read"}
+	id := msauth.NewClientViaDeviceFlow(authority, "client", nil, scopes...).ID()
+	if !reflect.DeepEqual(scopes, []string{"offline_access", "Mail.Read", "mail.read"}) {
+		t.Fatalf("the scopes are mutated: %v", scopes)
+	}
+
+	// The scope set is case insensitive and unordered.
+	if other := msauth.NewClientViaDeviceFlow(authority, "client", nil, "mail.read", "OFFLINE_ACCESS").ID(); other != id {
+		t.Fatalf("expect the same ID for the same scope set, got %q and %q", id, other)
+	}
+	if other := msauth.NewClientViaDeviceFlow(authority, "client", nil, "Mail.ReadWrite", "offline_access").ID(); other == id {
+		t.Fatalf("expect different IDs for different scope sets, got %q", id)
+	}
+}
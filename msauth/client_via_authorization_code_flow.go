@@ -12,7 +12,6 @@ import (
 	"github.com/hashicorp/go-retryablehttp"
 	"github.com/pkg/browser"
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/microsoft"
 )
 
 type authorizationCodeAuth struct {
@@ -20,14 +19,24 @@ type authorizationCodeAuth struct {
 	err   error
 }
 
+// AuthorizationURLCallback is invoked with the authorization URL, which the user needs to visit in a web browser to sign in.
+type AuthorizationURLCallback func(authURL string) error
+
+func defaultAuthorizationURLCallback(authURL string) error {
+	return browser.OpenURL(authURL)
+}
+
 type clientViaAuthorizationCodeFlow struct {
-	client *HTTPClient
-	config *oauth2.Config
+	client     *HTTPClient
+	config     *oauth2.Config
+	credential ClientCredential
+	f          AuthorizationURLCallback
+	login      LoginOptions
 }
 
 func (c *clientViaAuthorizationCodeFlow) ObtainTokenSource(ctx context.Context, t *oauth2.Token) (oauth2.TokenSource, error) {
 	var err error
-	ts := c.config.TokenSource(ctx, t)
+	ts := newRefreshTokenSource(c.client, c.config, c.credential, t)
 	_, err = ts.Token()
 	if err != nil {
 		return nil, err
@@ -41,101 +50,67 @@ func (c *clientViaAuthorizationCodeFlow) ID() string {
 
 func (c *clientViaAuthorizationCodeFlow) ObtainToken(ctx context.Context) (*oauth2.Token, error) {
 
-	state := randStringRunes(5)
+	state, err := randBase64URL(16)
+	if err != nil {
+		return nil, fmt.Errorf("generating state: %w", err)
+	}
+
+	// Public clients have no credential to authenticate themselves while redeeming the authorization code,
+	// in which case PKCE is used to protect the code from being intercepted.
+	var verifier *pkce
+	if isPublicClient(c.credential) {
+		verifier, err = newPKCE()
+		if err != nil {
+			return nil, fmt.Errorf("generating PKCE code verifier: %w", err)
+		}
+	}
 
-	// launch the http server
-	ch := make(chan authorizationCodeAuth)
-	closech := make(chan error)
-	redirectURL, err := url.Parse(c.config.RedirectURL)
+	// launch the loopback server receiving the authorization response
+	srv, err := newLoopbackServer(c.config.RedirectURL)
 	if err != nil {
 		return nil, err
 	}
-	srv := &http.Server{Addr: redirectURL.Host}
-	go func() {
-		rurl, err := url.Parse(c.config.RedirectURL)
-		if err != nil {
-			ch <- authorizationCodeAuth{
-				err: err,
-			}
+	defer srv.shutdown()
+	ch := make(chan authorizationCodeAuth, 1)
+	srv.serve(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if newstate := query.Get("state"); newstate != state {
+			// This is not the response of the ongoing authorization request, keep waiting for it.
+			log.Printf("[WARN] ignoring authorization response with unexpected state %q", newstate)
+			writeLoopbackPage(w, errors.New("the state of the authorization response mismatches"))
 			return
 		}
-		http.HandleFunc(rurl.Path, func(w http.ResponseWriter, r *http.Request) {
-			log.Printf("[INFO] handle request")
-			newstate := r.URL.Query().Get("state")
-			if newstate != state {
-				ch <- authorizationCodeAuth{
-					err: fmt.Errorf("state diff (origin: %s; new: %s)", state, newstate),
-				}
-				return
-			}
-			code := r.URL.Query().Get("code")
-			if code == "" {
-				ch <- authorizationCodeAuth{
-					err: errors.New("authorization code is empty"),
-				}
-				return
-			}
-
-			// request token
-			body := url.Values{
-				"grant_type":    {"authorization_code"},
-				"client_id":     {c.config.ClientID},
-				"client_secret": {c.config.ClientSecret},
-				"scope":         {strings.Join(c.config.Scopes, " ")},
-				"redirect_uri":  {c.config.RedirectURL},
-				"code":          {code},
-			}
-			req, err := NewRequestWithContext(ctx, http.MethodPost, c.config.Endpoint.TokenURL, strings.NewReader(body.Encode()))
-			if err != nil {
-				ch <- authorizationCodeAuth{
-					err: err,
-				}
-				return
-			}
-
-			token, _, err := c.client.DoToken(req)
-			if err != nil {
-				ch <- authorizationCodeAuth{
-					err: fmt.Errorf("access token response: %w", err),
-				}
-				return
-			}
-
-			ch <- authorizationCodeAuth{token: token.ToOauth2Token()}
-
-			w.Write([]byte(`
-<!DOCTYPE html>
-<html>
-<body>
-<p><b>You have successfully logged in!</b></p>
-You can close this window now.
-</body>
-</html>
-`))
-		})
-		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-			ch <- authorizationCodeAuth{
-				err: fmt.Errorf("Authorization Code local server failed to serve: %v", err),
-			}
-			return
+		token, err := c.redeem(ctx, query, srv.redirectURL, verifier)
+
+		// Write the page before sending the result, after which the server is shut down.
+		writeLoopbackPage(w, err)
+		select {
+		case ch <- authorizationCodeAuth{token: token, err: err}:
+		default:
 		}
-		closech <- nil
-		return
-	}()
+	})
 
 	// send authorization request
 	query := url.Values{
 		"response_type": {"code"},
 		"response_mode": {"query"},
 		"client_id":     {c.config.ClientID},
-		"scope":         {strings.Join(c.config.Scopes, " ")},
-		"redirect_uri":  {c.config.RedirectURL},
+		"scope":         {strings.Join(oidcScopes(c.config.Scopes), " ")},
+		"redirect_uri":  {srv.redirectURL},
 		"state":         {state},
 	}
-	defer srv.Close()
+	c.login.addParams(query)
+	if verifier != nil {
+		query.Set("code_challenge", verifier.challenge())
+		query.Set("code_challenge_method", "S256")
+	}
 
-	if err := browser.OpenURL(fmt.Sprintf("%s?%s", c.config.Endpoint.AuthURL, query.Encode())); err != nil {
-		return nil, err
+	f := c.f
+	if f == nil {
+		f = defaultAuthorizationURLCallback
+	}
+	if err := f(fmt.Sprintf("%s?%s", c.config.Endpoint.AuthURL, query.Encode())); err != nil {
+		return nil, fmt.Errorf("invoking callback: %w", err)
 	}
 
 	// wait for token
@@ -144,37 +119,84 @@ You can close this window now.
 		if result.err != nil {
 			return nil, result.err
 		}
-		// close the http server
-		if err := srv.Close(); err != nil {
-			return nil, fmt.Errorf("failed to close server: %w", err)
-		}
-		// wait for http server to quit
-		select {
-		case result := <-ch:
-			if result.err != nil {
-				return nil, fmt.Errorf("server is closing: %w", result.err)
-			}
-		case <-closech:
-			return result.token, result.err
+		if err := srv.shutdown(); err != nil {
+			return nil, fmt.Errorf("shutting down the local server: %w", err)
 		}
+		return result.token, nil
+	case <-srv.done:
+		return nil, srv.err
 	case <-ctx.Done():
-		return nil, errors.New("time out or canceled")
+		return nil, fmt.Errorf("waiting for the user to sign in: %w", ctx.Err())
 	}
+}
 
-	return nil, errors.New("never reach here")
+// redeem redeems the authorization code in the authorization response for the token.
+func (c *clientViaAuthorizationCodeFlow) redeem(ctx context.Context, query url.Values, redirectURL string, verifier *pkce) (*oauth2.Token, error) {
+	// The error response shares the same form as the one of the token endpoint.
+	// (See https://tools.ietf.org/html/rfc6749#section-4.1.2.1)
+	if e := query.Get("error"); e != "" {
+		autherr := TokenError{Error: e}
+		if v := query.Get("error_description"); v != "" {
+			autherr.ErrorDescription = &v
+		}
+		if v := query.Get("error_uri"); v != "" {
+			autherr.ErrorURI = &v
+		}
+		return nil, fmt.Errorf("authorization response: %s", autherr.String())
+	}
+	code := query.Get("code")
+	if code == "" {
+		return nil, errors.New("authorization code is empty")
+	}
+
+	// request token
+	body := url.Values{
+		"grant_type":   {"authorization_code"},
+		"client_id":    {c.config.ClientID},
+		"scope":        {strings.Join(oidcScopes(c.config.Scopes), " ")},
+		"redirect_uri": {redirectURL},
+		"code":         {code},
+	}
+	if verifier != nil {
+		body.Set("code_verifier", verifier.verifier)
+	}
+	if err := addClientCredential(body, c.credential, c.config.ClientID, c.config.Endpoint.TokenURL); err != nil {
+		return nil, err
+	}
+	if err := addClaims(body, ""); err != nil {
+		return nil, err
+	}
+	req, err := NewFormRequestWithContext(ctx, c.config.Endpoint.TokenURL, body)
+	if err != nil {
+		return nil, err
+	}
+	token, tokenerr, err := c.client.DoToken(req)
+	if err != nil {
+		return nil, fmt.Errorf("access token response: %w", err)
+	}
+	if tokenerr != nil {
+		return nil, fmt.Errorf("access token response: %s", tokenerr.String())
+	}
+	return token.ToOauth2Token(), nil
 }
 
-func NewClientViaAuthorizationCodeFlow(tenantID, clientID, clientSecret, redirectURL string, scopes ...string) Client {
+// NewClientViaAuthorizationCodeFlow creates a Client using the authorization code flow.
+// The "credential" is only needed for confidential clients, it can be nil or an empty ClientSecret for public clients.
+// The "f" is invoked with the authorization URL, it opens the URL in the default web browser if nil.
+// The "redirectURL" is a loopback URL served by a local server during the flow. If its port is absent or 0 (e.g. "http://localhost"),
+// an ephemeral port is used, which is supported by the Microsoft identity platform for loopback redirect URLs.
+func NewClientViaAuthorizationCodeFlow(authority Authority, clientID string, credential ClientCredential, redirectURL string, f AuthorizationURLCallback, scopes ...string) Client {
 	client := retryablehttp.NewClient()
 	client.Logger = nil
 	return &clientViaAuthorizationCodeFlow{
 		client: NewHTTPClient(client),
 		config: &oauth2.Config{
-			ClientID:     clientID,
-			ClientSecret: clientSecret,
-			Endpoint:     microsoft.AzureADEndpoint(tenantID),
-			RedirectURL:  redirectURL,
-			Scopes:       scopes,
+			ClientID:    clientID,
+			Endpoint:    authority.Endpoint(),
+			RedirectURL: redirectURL,
+			Scopes:      scopes,
 		},
+		credential: credential,
+		f:          f,
 	}
 }
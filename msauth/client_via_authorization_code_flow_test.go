@@ -2,11 +2,18 @@ package msauth_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/magodo/terraform-provider-outlook/msauth"
+	"github.com/magodo/terraform-provider-outlook/msauth/authtest"
 )
 
 func TestObtainTokenViaAuthorizationCodeFlow(t *testing.T) {
@@ -27,7 +34,7 @@ func TestObtainTokenViaAuthorizationCodeFlow(t *testing.T) {
 		"offline_access",
 	}
 
-	c := msauth.NewClientViaAuthorizationCodeFlow("common", clientID, clientSecret, redirectURL, scopes...)
+	c := msauth.NewClientViaAuthorizationCodeFlow(msauth.Authority{Host: msauth.AuthorityHostPublic, TenantID: "common"}, clientID, msauth.ClientSecret(clientSecret), redirectURL, nil, scopes...)
 
 	tk, err := c.ObtainToken(context.Background())
 	if err != nil {
@@ -42,3 +49,217 @@ func TestObtainTokenViaAuthorizationCodeFlow(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// newTestTokenServer starts a token endpoint, which issues a token for the authorization code "good",
+// and rejects any other code.
+func newTestTokenServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("code") != "good" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant", "error_description": "the code is invalid"}`))
+			return
+		}
+		if r.PostForm.Get("code_verifier") == "" {
+			t.Error("code_verifier is missing for public client")
+		}
+		w.Write([]byte(`{"access_token": "at", "token_type": "Bearer", "expires_in": 3600, "refresh_token": "rt"}`))
+	}))
+}
+
+func TestObtainTokenViaAuthorizationCodeFlow_loopback(t *testing.T) {
+	tokenServer := newTestTokenServer(t)
+	defer tokenServer.Close()
+	authority := msauth.Authority{Host: tokenServer.URL, TenantID: "common"}
+
+	cases := []struct {
+		name     string
+		response func(state string) url.Values
+		err      string
+		page     string
+	}{
+		{
+			name:     "success",
+			response: func(state string) url.Values { return url.Values{"code": {"good"}, "state": {state}} },
+			page:     "You have successfully logged in!",
+		},
+		{
+			name:     "token error",
+			response: func(state string) url.Values { return url.Values{"code": {"bad"}, "state": {state}} },
+			err:      "invalid_grant: the code is invalid",
+			page:     "Failed to log in!",
+		},
+		{
+			name: "authorization error",
+			response: func(state string) url.Values {
+				return url.Values{"error": {"access_denied"}, "error_description": {"the user <b>declined</b>"}, "state": {state}}
+			},
+			err:  "access_denied: the user <b>declined</b>",
+			page: "the user &lt;b&gt;declined&lt;/b&gt;",
+		},
+	}
+
+	// The loopback servers of multiple logins in the same process must not conflict.
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var page string
+			// The callback plays as the browser, which follows the redirection of the authorization server.
+			f := func(authURL string) error {
+				u, err := url.Parse(authURL)
+				if err != nil {
+					return err
+				}
+				redirectURL, err := url.Parse(u.Query().Get("redirect_uri"))
+				if err != nil {
+					return err
+				}
+				if redirectURL.Port() == "" || redirectURL.Port() == "0" {
+					return fmt.Errorf("ephemeral port is not allocated: %s", redirectURL)
+				}
+				redirectURL.RawQuery = c.response(u.Query().Get("state")).Encode()
+				resp, err := http.Get(redirectURL.String())
+				if err != nil {
+					return err
+				}
+				defer resp.Body.Close()
+				b, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					return err
+				}
+				page = string(b)
+				return nil
+			}
+
+			client := msauth.NewClientViaAuthorizationCodeFlow(authority, "client", nil, "http://localhost", f, "mail.readwrite")
+			token, err := client.ObtainToken(context.Background())
+			if c.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if token.AccessToken != "at" {
+					t.Fatalf("expect access token at, got %s", token.AccessToken)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Fatalf("expect error containing %q, got %v", c.err, err)
+			}
+			if !strings.Contains(page, c.page) {
+				t.Fatalf("expect page containing %q, got %s", c.page, page)
+			}
+		})
+	}
+}
+
+func TestObtainTokenViaAuthorizationCodeFlow_cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	f := func(authURL string) error {
+		cancel()
+		return nil
+	}
+	client := msauth.NewClientViaAuthorizationCodeFlow(msauth.Authority{Host: "http://127.0.0.1:0", TenantID: "common"}, "client", nil, "http://localhost", f, "mail.readwrite")
+	if _, err := client.ObtainToken(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect context canceled error, got %v", err)
+	}
+}
+
+// browse plays as the web browser visiting the authorization URL, which follows the redirection to the loopback server.
+func browse(authURL string) error {
+	resp, err := http.Get(authURL)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestObtainTokenViaAuthorizationCodeFlow_authtest(t *testing.T) {
+	server := authtest.NewServer()
+	defer server.Close()
+	server.Secrets["confidential"] = "secret"
+
+	cases := []struct {
+		name           string
+		clientID       string
+		credential     msauth.ClientCredential
+		authorizeError string
+		err            string
+	}{
+		{
+			name:     "public client",
+			clientID: "public",
+		},
+		{
+			name:       "confidential client",
+			clientID:   "confidential",
+			credential: msauth.ClientSecret("secret"),
+		},
+		{
+			name:       "wrong client secret",
+			clientID:   "confidential",
+			credential: msauth.ClientSecret("wrong"),
+			err:        "AADSTS7000215",
+		},
+		{
+			name:           "consent declined",
+			clientID:       "public",
+			authorizeError: "access_denied",
+			err:            "access_denied: AADSTS65004",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server.AuthorizeError = c.authorizeError
+			client := msauth.NewClientViaAuthorizationCodeFlow(server.Authority("organizations"), c.clientID, c.credential, "http://localhost", browse, "mail.readwrite", "offline_access")
+			token, err := client.ObtainToken(context.Background())
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expect error containing %q, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := msauth.AccessTokenClaims(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if missing := claims.MissingPermissions("Mail.ReadWrite"); len(missing) != 0 {
+				t.Fatalf("expect the scopes granted, missing %v", missing)
+			}
+			if token.RefreshToken == "" {
+				t.Fatal("expect a refresh token for offline_access")
+			}
+		})
+	}
+}
+
+func TestObtainTokenViaAuthorizationCodeFlow_loginOptions(t *testing.T) {
+	server := authtest.NewServer()
+	defer server.Close()
+
+	var query url.Values
+	f := func(authURL string) error {
+		u, err := url.Parse(authURL)
+		if err != nil {
+			return err
+		}
+		query = u.Query()
+		return browse(authURL)
+	}
+	client := msauth.NewClientViaAuthorizationCodeFlow(server.Authority("common"), "client", nil, "http://localhost", f, "mail.read")
+	opts := msauth.LoginOptions{LoginHint: authtest.DefaultUser.Username, DomainHint: "contoso.com", Prompt: "select_account"}
+	if _, err := msauth.WithLoginOptions(client, opts).ObtainToken(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{"login_hint": opts.LoginHint, "domain_hint": opts.DomainHint, "prompt": opts.Prompt} {
+		if query.Get(k) != v {
+			t.Fatalf("expect %s=%s in the authorization request, got %q", k, v, query.Get(k))
+		}
+	}
+	if scopes := query.Get("scope"); !strings.Contains(scopes, "openid") || !strings.Contains(scopes, "profile") {
+		t.Fatalf("expect the OpenID Connect scopes requested, got %q", scopes)
+	}
+}
@@ -3,14 +3,12 @@ package msauth
 import (
 	"context"
 	"fmt"
-	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/go-retryablehttp"
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/microsoft"
 )
 
 type DeviceAuthorizationAuth struct {
@@ -25,9 +23,13 @@ type DeviceAuthorizationAuth struct {
 type DeviceAuthorizationCallback func(auth DeviceAuthorizationAuth) error
 
 type clientViaDeviceFlow struct {
-	client *HTTPClient
-	config *oauth2.Config
-	f      DeviceAuthorizationCallback
+	client        *HTTPClient
+	config        *oauth2.Config
+	deviceAuthURL string
+	f             DeviceAuthorizationCallback
+	// login is only used to select the cached token and verify the signed-in account, as the device authorization
+	// request has no parameter to customize the sign-in page.
+	login LoginOptions
 }
 
 func defaultDeviceAuthorizationCallback(auth DeviceAuthorizationAuth) error {
@@ -41,7 +43,7 @@ func (c *clientViaDeviceFlow) ID() string {
 }
 
 func (c *clientViaDeviceFlow) ObtainTokenSource(ctx context.Context, t *oauth2.Token) (oauth2.TokenSource, error) {
-	ts := c.config.TokenSource(ctx, t)
+	ts := newRefreshTokenSource(c.client, c.config, nil, t)
 	if _, err := ts.Token(); err != nil {
 		return nil, err
 	}
@@ -52,14 +54,12 @@ func (c *clientViaDeviceFlow) ObtainToken(ctx context.Context) (*oauth2.Token, e
 	// Device authorization
 	body := url.Values{
 		"client_id": {c.config.ClientID},
-		"scope":     {strings.Join(c.config.Scopes, " ")},
+		"scope":     {strings.Join(oidcScopes(c.config.Scopes), " ")},
 	}
-	deviceUrl := strings.ReplaceAll(c.config.Endpoint.TokenURL, "v2.0/token", "v2.0/devicecode")
-	req, err := NewRequestWithContext(ctx, http.MethodPost, deviceUrl, strings.NewReader(body.Encode()))
+	req, err := NewFormRequestWithContext(ctx, c.deviceAuthURL, body)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("Accept", "application/x-www-form-urlencoded")
 	var auth DeviceAuthorizationAuth
 	if err := c.client.Do(req, &auth); err != nil {
 		return nil, err
@@ -80,13 +80,17 @@ func (c *clientViaDeviceFlow) ObtainToken(ctx context.Context) (*oauth2.Token, e
 		"device_code": {auth.DeviceCode},
 		"client_id":   {c.config.ClientID},
 	}
+	if err := addClaims(body, ""); err != nil {
+		return nil, err
+	}
 
 	interval := 5
 	if auth.Interval != nil {
 		interval = *auth.Interval
 	}
+	expiry := time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second)
 	for {
-		req, err := NewRequestWithContext(ctx, http.MethodPost, c.config.Endpoint.TokenURL, strings.NewReader(body.Encode()))
+		req, err := NewFormRequestWithContext(ctx, c.config.Endpoint.TokenURL, body)
 		if err != nil {
 			return nil, err
 		}
@@ -97,35 +101,40 @@ func (c *clientViaDeviceFlow) ObtainToken(ctx context.Context) (*oauth2.Token, e
 		if tokenerr != nil {
 			switch tokenerr.Error {
 			case TokenErrorAuthorizationPending:
-				time.Sleep(time.Duration(interval) * time.Second)
-				continue
 			case TokenErrorSlowDown:
 				interval += 5
-				time.Sleep(time.Duration(interval) * time.Second)
-				continue
-			// In case authorization request was denied by user, there is no special handling for now.
-			//case TokenErrorAccessDenied:
-			//	return nil, errors.New(tokenerr.String())
+			case TokenErrorAccessDenied, TokenErrorAuthorizationDeclined:
+				return nil, fmt.Errorf("the sign-in was declined by the user: %s", tokenerr.String())
 			case TokenErrorExpiredToken:
-				return c.ObtainToken(ctx)
+				return nil, fmt.Errorf("the device code expired before the user completed the sign-in: %s", tokenerr.String())
 			default:
 				return nil, fmt.Errorf("access token response: %s", tokenerr.String())
 			}
+			if auth.ExpiresIn > 0 && time.Now().After(expiry) {
+				return nil, fmt.Errorf("the device code expired before the user completed the sign-in (within %d sec)", auth.ExpiresIn)
+			}
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("waiting for the user to sign in: %w", ctx.Err())
+			case <-time.After(time.Duration(interval) * time.Second):
+			}
+			continue
 		}
 		return token.ToOauth2Token(), nil
 	}
 }
 
-func NewClientViaDeviceFlow(tenantID string, clientID string, f DeviceAuthorizationCallback, scopes ...string) Client {
+func NewClientViaDeviceFlow(authority Authority, clientID string, f DeviceAuthorizationCallback, scopes ...string) Client {
 	client := retryablehttp.NewClient()
 	client.Logger = nil
 	return &clientViaDeviceFlow{
 		client: NewHTTPClient(client),
 		config: &oauth2.Config{
 			ClientID: clientID,
-			Endpoint: microsoft.AzureADEndpoint(tenantID),
+			Endpoint: authority.Endpoint(),
 			Scopes:   scopes,
 		},
-		f: f,
+		deviceAuthURL: authority.DeviceAuthorizationURL(),
+		f:             f,
 	}
 }
@@ -2,11 +2,15 @@ package msauth_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/magodo/terraform-provider-outlook/msauth"
+	"github.com/magodo/terraform-provider-outlook/msauth/authtest"
 )
 
 func TestObtainTokenViaDeviceFlow(t *testing.T) {
@@ -24,7 +28,7 @@ func TestObtainTokenViaDeviceFlow(t *testing.T) {
 	}
 
 	clientID := "23bd8cd9-a50b-4839-b522-67b77d5db7da"
-	c := msauth.NewClientViaDeviceFlow("common", clientID, nil, scopes...)
+	c := msauth.NewClientViaDeviceFlow(msauth.Authority{Host: msauth.AuthorityHostPublic, TenantID: "common"}, clientID, nil, scopes...)
 	tk, err := c.ObtainToken(context.Background())
 	if err != nil {
 		t.Fatal(err)
@@ -38,3 +42,132 @@ func TestObtainTokenViaDeviceFlow(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestObtainTokenViaDeviceFlow_offline(t *testing.T) {
+	cases := []struct {
+		name      string
+		responses []string
+		err       string
+		slow      bool
+	}{
+		{
+			name:      "success",
+			responses: []string{msauth.TokenErrorAuthorizationPending, msauth.TokenErrorAuthorizationPending},
+		},
+		{
+			name:      "slow down",
+			responses: []string{msauth.TokenErrorSlowDown},
+			slow:      true,
+		},
+		{
+			name:      "declined",
+			responses: []string{msauth.TokenErrorAuthorizationPending, msauth.TokenErrorAuthorizationDeclined},
+			err:       "the sign-in was declined by the user",
+		},
+		{
+			name:      "expired",
+			responses: []string{msauth.TokenErrorExpiredToken},
+			err:       "the device code expired",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if c.slow && testing.Short() {
+				t.Skip("the polling interval is increased by 5 seconds")
+			}
+			server := authtest.NewServer()
+			defer server.Close()
+			server.DeviceResponses = c.responses
+
+			var userCode string
+			f := func(auth msauth.DeviceAuthorizationAuth) error {
+				userCode = auth.UserCode
+				return nil
+			}
+			client := msauth.NewClientViaDeviceFlow(server.Authority("common"), "client", f, "mail.read", "offline_access")
+			token, err := client.ObtainToken(context.Background())
+			if userCode == "" {
+				t.Fatal("expect the user code to be shown")
+			}
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expect error containing %q, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(server.TokenRequests()); n != len(c.responses)+1 {
+				t.Fatalf("expect %d token requests, got %d", len(c.responses)+1, n)
+			}
+			claims, err := msauth.IDTokenClaims(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Username() != authtest.DefaultUser.Username {
+				t.Fatalf("expect signed in as %s, got %s", authtest.DefaultUser.Username, claims.Username())
+			}
+		})
+	}
+}
+
+func TestObtainTokenViaDeviceFlow_cancel(t *testing.T) {
+	server := authtest.NewServer()
+	defer server.Close()
+	server.DeviceResponses = []string{msauth.TokenErrorAuthorizationPending, msauth.TokenErrorAuthorizationPending}
+	server.DeviceInterval = 60
+
+	// The user never signs in, while the login is canceled (e.g. Terraform stops the provider).
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f := func(auth msauth.DeviceAuthorizationAuth) error {
+		time.AfterFunc(100*time.Millisecond, cancel)
+		return nil
+	}
+	client := msauth.NewClientViaDeviceFlow(server.Authority("common"), "client", f, "mail.read", "offline_access")
+
+	start := time.Now()
+	_, err := client.ObtainToken(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect the login canceled, got %v", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("expect the login aborted right after canceled, took %s", d)
+	}
+}
+
+func TestObtainTokenSourceViaDeviceFlow_refresh(t *testing.T) {
+	server := authtest.NewServer()
+	defer server.Close()
+	client := msauth.NewClientViaDeviceFlow(server.Authority("common"), "client", func(msauth.DeviceAuthorizationAuth) error { return nil }, "mail.read", "offline_access")
+	token, err := client.ObtainToken(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The expired token is refreshed, with the refresh token rotated.
+	token.Expiry = time.Now().Add(-time.Minute)
+	ts, err := client.ObtainTokenSource(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newToken.AccessToken == token.AccessToken || newToken.RefreshToken == token.RefreshToken {
+		t.Fatal("expect the token to be refreshed")
+	}
+	requests := server.TokenRequests()
+	if last := requests[len(requests)-1]; last.Get("grant_type") != "refresh_token" || last.Get("refresh_token") != token.RefreshToken {
+		t.Fatalf("expect the refresh token grant, got %v", last)
+	}
+
+	// The revoked refresh token can't be redeemed.
+	server.RevokeRefreshTokens()
+	if _, err := client.ObtainTokenSource(context.Background(), token); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("expect invalid_grant error, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package msauth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"golang.org/x/oauth2"
+)
+
+// clientViaPassword obtains the token by the resource owner password credentials (ROPC) grant, i.e. with the username
+// and password of the user.
+// (See https://docs.microsoft.com/en-us/azure/active-directory/develop/v2-oauth-ropc)
+type clientViaPassword struct {
+	client     *HTTPClient
+	config     *oauth2.Config
+	credential ClientCredential
+	username   string
+	password   string
+}
+
+func (c *clientViaPassword) ID() string {
+	return clientIdentifier(c.config.ClientID, c.config.Endpoint.TokenURL, c.config.Scopes)
+}
+
+func (c *clientViaPassword) ObtainTokenSource(ctx context.Context, t *oauth2.Token) (oauth2.TokenSource, error) {
+	ts := newRefreshTokenSource(c.client, c.config, c.credential, t)
+	if _, err := ts.Token(); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+func (c *clientViaPassword) ObtainToken(ctx context.Context) (*oauth2.Token, error) {
+	body := url.Values{
+		"grant_type": {"password"},
+		"client_id":  {c.config.ClientID},
+		"scope":      {strings.Join(oidcScopes(c.config.Scopes), " ")},
+		"username":   {c.username},
+		"password":   {c.password},
+	}
+	if err := addClientCredential(body, c.credential, c.config.ClientID, c.config.Endpoint.TokenURL); err != nil {
+		return nil, err
+	}
+	if err := addClaims(body, ""); err != nil {
+		return nil, err
+	}
+	req, err := NewFormRequestWithContext(ctx, c.config.Endpoint.TokenURL, body)
+	if err != nil {
+		return nil, err
+	}
+	token, tokenerr, err := c.client.DoToken(req)
+	if err != nil {
+		return nil, fmt.Errorf("access token response: %w", err)
+	}
+	if tokenerr != nil {
+		return nil, fmt.Errorf("access token response: %s", tokenerr.String())
+	}
+	return token.ToOauth2Token(), nil
+}
+
+// NewClientViaPassword creates a Client using the resource owner password credentials grant, which signs in the user
+// by the username and password without any interaction.
+//
+// It is NOT recommended for production: the password is handled by the client, and the grant fails for the accounts
+// requiring MFA or any other interaction (e.g. consent), the personal Microsoft accounts and the federated accounts.
+// It is meant for the unattended tests in a dedicated tenant.
+// The "credential" is only needed for confidential clients, it can be nil or an empty ClientSecret for public clients.
+func NewClientViaPassword(authority Authority, clientID string, credential ClientCredential, username, password string, scopes ...string) Client {
+	client := retryablehttp.NewClient()
+	client.Logger = nil
+	return &clientViaPassword{
+		client: NewHTTPClient(client),
+		config: &oauth2.Config{
+			ClientID: clientID,
+			Endpoint: authority.Endpoint(),
+			Scopes:   scopes,
+		},
+		credential: credential,
+		username:   username,
+		password:   password,
+	}
+}
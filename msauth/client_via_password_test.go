@@ -0,0 +1,57 @@
+package msauth_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/magodo/terraform-provider-outlook/msauth"
+	"github.com/magodo/terraform-provider-outlook/msauth/authtest"
+)
+
+func TestObtainTokenViaPassword(t *testing.T) {
+	server := authtest.NewServer()
+	defer server.Close()
+	server.Passwords[authtest.DefaultUser.Username] = "P@ssw0rd"
+	authority := server.Authority(authtest.DefaultTenantID)
+
+	client := msauth.NewClientViaPassword(authority, "client", nil, authtest.DefaultUser.Username, "wrong", "mail.read", "offline_access")
+	if _, err := client.ObtainToken(context.Background()); err == nil || !strings.Contains(err.Error(), "AADSTS50126") {
+		t.Fatalf("expect invalid password error, got %v", err)
+	}
+
+	client = msauth.NewClientViaPassword(authority, "client", nil, authtest.DefaultUser.Username, "P@ssw0rd", "mail.read", "offline_access")
+	app := msauth.NewApp()
+	for i := 0; i < 2; i++ {
+		ts, err := app.ObtainTokenSourceViaClient(context.Background(), client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := ts.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := msauth.AccessTokenClaims(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.Username() != authtest.DefaultUser.Username {
+			t.Fatalf("expect signed in as %s, got %s", authtest.DefaultUser.Username, claims.Username())
+		}
+	}
+
+	// The token is cached for the user, hence the password is only sent once.
+	var passwordGrants int
+	for _, form := range server.TokenRequests() {
+		if form.Get("grant_type") == "password" {
+			passwordGrants++
+		}
+	}
+	if passwordGrants != 2 {
+		t.Fatalf("expect 2 password grants (including the failed one), got %d", passwordGrants)
+	}
+	entries := app.CacheEntries()
+	if len(entries) != 1 || entries[0].Account == nil || entries[0].Account.Username != authtest.DefaultUser.Username {
+		t.Fatalf("unexpected cache entries: %+v", entries)
+	}
+}
@@ -0,0 +1,136 @@
+package msauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// commandToken is the token written to stdout by a credential command. Besides the snake case fields, the output of
+// `az account get-access-token` is accepted as well.
+type commandToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	// ExpiresIn is the lifetime of the token in seconds.
+	ExpiresIn json.Number `json:"expires_in"`
+	// ExpiresOn is the expiry of the token in unix seconds.
+	ExpiresOn json.Number `json:"expires_on"`
+	// Expiry is the expiry of the token in RFC 3339 format.
+	Expiry *time.Time `json:"expiry"`
+
+	AzAccessToken string `json:"accessToken"`
+	AzTokenType   string `json:"tokenType"`
+	// AzExpiresOn is the expiry of the token in local time, e.g. "2020-01-01 00:00:00.000000", which is the only expiry
+	// returned by the old az versions.
+	AzExpiresOn string `json:"expiresOn"`
+}
+
+// azExpiresOnLayout is the layout of AzExpiresOn.
+const azExpiresOnLayout = "2006-01-02 15:04:05.999999"
+
+func (t commandToken) token(now time.Time) (*oauth2.Token, error) {
+	token := &oauth2.Token{
+		AccessToken: t.AccessToken,
+		TokenType:   t.TokenType,
+	}
+	if token.AccessToken == "" {
+		token.AccessToken = t.AzAccessToken
+	}
+	if token.TokenType == "" {
+		token.TokenType = t.AzTokenType
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("no access token")
+	}
+
+	switch {
+	case t.Expiry != nil:
+		token.Expiry = *t.Expiry
+	case t.ExpiresOn != "":
+		v, err := t.ExpiresOn.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid expires_on: %v", err)
+		}
+		token.Expiry = time.Unix(v, 0)
+	case t.ExpiresIn != "":
+		v, err := t.ExpiresIn.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid expires_in: %v", err)
+		}
+		token.Expiry = now.Add(time.Duration(v) * time.Second)
+	case t.AzExpiresOn != "":
+		v, err := time.ParseInLocation(azExpiresOnLayout, t.AzExpiresOn, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiresOn: %v", err)
+		}
+		token.Expiry = v
+	default:
+		// Otherwise, the token would be reused forever.
+		return nil, errors.New("no expiry")
+	}
+	return token, nil
+}
+
+// commandTokenSource runs the credential command, whose token is reused until it is about to expire.
+type commandTokenSource struct {
+	command []string
+
+	mutex sync.Mutex
+	t     *oauth2.Token
+}
+
+func (ts *commandTokenSource) Token() (*oauth2.Token, error) {
+	return ts.TokenWithContext(context.Background())
+}
+
+// TokenWithContext runs the command (if the token is about to expire), which is killed once ctx is done or
+// DefaultCommandTimeout expires.
+func (ts *commandTokenSource) TokenWithContext(ctx context.Context) (*oauth2.Token, error) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	if ts.t.Valid() {
+		return ts.t, nil
+	}
+	if len(ts.command) == 0 {
+		return nil, errors.New("credential command is empty")
+	}
+	b, err := runCommand(ctx, 0, ts.command, nil)
+	if err != nil {
+		return nil, fmt.Errorf("running credential command %q: %w", ts.command[0], err)
+	}
+	var t commandToken
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, fmt.Errorf("decoding the output of credential command %q: %w", ts.command[0], err)
+	}
+	token, err := t.token(time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("invalid output of credential command %q: %w", ts.command[0], err)
+	}
+	ts.t = token
+	return token, nil
+}
+
+// NewCommandTokenSource returns a TokenSource which obtains the access token by running an external command, which writes
+// a JSON object to stdout in the form of:
+//
+//	{"access_token": "...", "expires_on": 1600000000}
+//
+// The expiry can be specified either by "expires_on" (unix seconds), "expires_in" (seconds) or "expiry" (RFC 3339).
+// The output of `az account get-access-token` is accepted as well, including the one of the old az versions whose expiry
+// is only specified by "expiresOn" (local time).
+//
+// The token is reused until it is about to expire, then the command is invoked again. The returned TokenSource is a
+// ContextTokenSource, the command is killed once the context is done or it doesn't finish within DefaultCommandTimeout.
+func NewCommandTokenSource(command ...string) oauth2.TokenSource {
+	return &commandTokenSource{command: command}
+}
+
+// NewStaticTokenSource returns a TokenSource which always returns the pre-obtained access token, which is not refreshed.
+func NewStaticTokenSource(accessToken string) oauth2.TokenSource {
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: accessToken, TokenType: "Bearer"})
+}
@@ -0,0 +1,144 @@
+package msauth_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magodo/terraform-provider-outlook/msauth"
+)
+
+func TestCommandTokenSource(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the credential command is a shell script")
+	}
+	dir, err := ioutil.TempDir("", "msauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The script records every invocation into the file specified by $0, and prints a token with a lifetime of $1 seconds.
+	script := `echo >> "$0"; printf '{"access_token": "token%s", "token_type": "Bearer", "expires_in": %s}' "$(wc -l < "$0" | tr -d ' ')" "$1"`
+
+	cases := []struct {
+		name        string
+		expiresIn   string
+		invocations int
+	}{
+		{
+			name:        "reused",
+			expiresIn:   "3600",
+			invocations: 1,
+		},
+		{
+			name:        "expired",
+			expiresIn:   "0",
+			invocations: 3,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			record := filepath.Join(dir, c.name)
+			ts := msauth.NewCommandTokenSource("sh", "-c", script, record, c.expiresIn)
+			for i := 0; i < 3; i++ {
+				token, err := ts.Token()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.HasPrefix(token.AccessToken, "token") {
+					t.Fatalf("unexpected access token: %s", token.AccessToken)
+				}
+			}
+			b, err := ioutil.ReadFile(record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := strings.Count(string(b), "\n"); n != c.invocations {
+				t.Fatalf("expect %d invocations, got %d", c.invocations, n)
+			}
+		})
+	}
+}
+
+func TestCommandTokenSource_az(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the credential command is a shell script")
+	}
+	ts := msauth.NewCommandTokenSource("sh", "-c", `echo '{"accessToken": "foo", "expiresOn": "2020-01-01 00:00:00.000000", "expires_on": 4102444800, "tokenType": "Bearer"}'`)
+	token, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "foo" {
+		t.Fatalf("expect access token foo, got %s", token.AccessToken)
+	}
+	if token.Expiry.Unix() != 4102444800 {
+		t.Fatalf("unexpected expiry: %v", token.Expiry)
+	}
+}
+
+func TestCommandTokenSource_azLegacy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the credential command is a shell script")
+	}
+	// The old az versions only return the expiry in local time.
+	ts := msauth.NewCommandTokenSource("sh", "-c", `echo '{"accessToken": "foo", "expiresOn": "2099-12-31 23:00:00.123456", "tokenType": "Bearer"}'`)
+	token, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := time.Date(2099, 12, 31, 23, 0, 0, 123456000, time.Local); !token.Expiry.Equal(expect) {
+		t.Fatalf("expect expiry %v, got %v", expect, token.Expiry)
+	}
+}
+
+func TestCommandTokenSource_invalid(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the credential command is a shell script")
+	}
+	for _, output := range []string{
+		`not json`,
+		`{"expires_in": 3600}`,
+		`{"access_token": "foo"}`,
+		`{"accessToken": "foo", "expiresOn": "tomorrow"}`,
+	} {
+		if _, err := msauth.NewCommandTokenSource("echo", output).Token(); err == nil {
+			t.Errorf("expect error for output %s", output)
+		}
+	}
+	if _, err := msauth.NewCommandTokenSource("false").Token(); err == nil {
+		t.Error("expect error for failed command")
+	}
+}
+
+func TestCommandTokenSource_context(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the credential command is a shell script")
+	}
+
+	// The stderr of the failed command is reported.
+	ts := msauth.NewCommandTokenSource("sh", "-c", `echo "Please run 'az login'" >&2; exit 1`)
+	if _, err := ts.Token(); err == nil || !strings.Contains(err.Error(), "az login") {
+		t.Fatalf("expect the stderr of the command reported, got %v", err)
+	}
+
+	// The hung command is killed once the context (e.g. of the request) is done.
+	ts = msauth.NewCommandTokenSource("sh", "-c", "sleep 10")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := msauth.TokenWithContext(ctx, ts); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect the command aborted by the context, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("expect the command killed once the context is done")
+	}
+}
@@ -0,0 +1,45 @@
+package msauth
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// ClientCredential authenticates a confidential client at the token endpoint.
+type ClientCredential interface {
+	// TokenRequestParams returns the client authentication parameters to add to a token request,
+	// which is sent to "tokenURL" on behalf of "clientID".
+	TokenRequestParams(clientID, tokenURL string) (url.Values, error)
+}
+
+// ClientSecret authenticates the client by a shared secret (i.e. oauth2 client_secret).
+// An empty ClientSecret represents a public client, which sends no credential at all.
+type ClientSecret string
+
+func (s ClientSecret) TokenRequestParams(clientID, tokenURL string) (url.Values, error) {
+	if s == "" {
+		return url.Values{}, nil
+	}
+	return url.Values{"client_secret": {string(s)}}, nil
+}
+
+// isPublicClient tells whether the credential represents a public client, which has no credential at all.
+func isPublicClient(credential ClientCredential) bool {
+	return credential == nil || credential == ClientSecret("")
+}
+
+// addClientCredential adds the client authentication parameters of "credential" into the token request "body".
+// A nil credential is regarded as a public client.
+func addClientCredential(body url.Values, credential ClientCredential, clientID, tokenURL string) error {
+	if credential == nil {
+		return nil
+	}
+	params, err := credential.TokenRequestParams(clientID, tokenURL)
+	if err != nil {
+		return fmt.Errorf("building client credential: %w", err)
+	}
+	for k, v := range params {
+		body[k] = v
+	}
+	return nil
+}
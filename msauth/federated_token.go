@@ -0,0 +1,59 @@
+package msauth
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// FederatedToken authenticates the client by an OIDC token issued by an external identity provider (e.g. GitHub Actions,
+// Kubernetes), which is trusted by the application via workload identity federation.
+// (See https://docs.microsoft.com/en-us/azure/active-directory/develop/workload-identity-federation)
+//
+// The OIDC token is short-lived and rotated by the external identity provider, hence it is read again for every token request.
+type FederatedToken struct {
+	path string
+	env  string
+}
+
+// NewFederatedTokenFromFile creates a FederatedToken reading the OIDC token from a file, e.g. the one specified by
+// the AZURE_FEDERATED_TOKEN_FILE environment variable in Kubernetes.
+func NewFederatedTokenFromFile(path string) *FederatedToken {
+	return &FederatedToken{path: path}
+}
+
+// NewFederatedTokenFromEnv creates a FederatedToken reading the OIDC token from an environment variable.
+func NewFederatedTokenFromEnv(name string) *FederatedToken {
+	return &FederatedToken{env: name}
+}
+
+func (t *FederatedToken) read() (string, error) {
+	if t.path != "" {
+		b, err := ioutil.ReadFile(t.path)
+		if err != nil {
+			return "", fmt.Errorf("reading federated token: %w", err)
+		}
+		if token := strings.TrimSpace(string(b)); token != "" {
+			return token, nil
+		}
+		return "", fmt.Errorf("federated token file %s is empty", t.path)
+	}
+	if token := strings.TrimSpace(os.Getenv(t.env)); token != "" {
+		return token, nil
+	}
+	return "", errors.New("federated token environment variable " + t.env + " is empty")
+}
+
+func (t *FederatedToken) TokenRequestParams(clientID, tokenURL string) (url.Values, error) {
+	token, err := t.read()
+	if err != nil {
+		return nil, err
+	}
+	return url.Values{
+		"client_assertion_type": {clientAssertionType},
+		"client_assertion":      {token},
+	}, nil
+}
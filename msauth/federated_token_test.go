@@ -0,0 +1,55 @@
+package msauth_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/magodo/terraform-provider-outlook/msauth"
+)
+
+func TestFederatedToken_TokenRequestParams(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "token")
+
+	cred := msauth.NewFederatedTokenFromFile(path)
+	if _, err := cred.TokenRequestParams("client", "https://login/token"); err == nil {
+		t.Fatal("expect error for nonexistent token file")
+	}
+
+	// The token file is read again for every token request.
+	for _, token := range []string{"foo", "bar"} {
+		if err := ioutil.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		params, err := cred.TokenRequestParams("client", "https://login/token")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := params.Get("client_assertion"); v != token {
+			t.Fatalf("expect client assertion %s, got %s", token, v)
+		}
+		if v := params.Get("client_assertion_type"); v != "urn:ietf:params:oauth:client-assertion-type:jwt-bearer" {
+			t.Fatalf("unexpected client_assertion_type: %s", v)
+		}
+	}
+}
+
+func TestFederatedToken_env(t *testing.T) {
+	const name = "MSAUTH_TEST_FEDERATED_TOKEN"
+	os.Setenv(name, "foo")
+	defer os.Unsetenv(name)
+
+	params, err := msauth.NewFederatedTokenFromEnv(name).TokenRequestParams("client", "https://login/token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := params.Get("client_assertion"); v != "foo" {
+		t.Fatalf("expect client assertion foo, got %s", v)
+	}
+}
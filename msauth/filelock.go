@@ -0,0 +1,131 @@
+package msauth
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// fileLockTimeout is how long to wait for acquiring a file lock.
+	fileLockTimeout = time.Minute
+
+	// fileLockStaleAge is how old a lock file is regarded as being left over by a crashed process.
+	// The lock is only held for a single read-modify-write of the file, which is much shorter than this.
+	fileLockStaleAge = 30 * time.Second
+)
+
+// fileLock is a cross-process lock of a file, held by owning a sibling lock file.
+type fileLock struct {
+	path string
+	// nonce is written into the lock file, which tells whether the lock file is still owned by this one.
+	nonce string
+}
+
+// lockFile acquires a cross-process lock of the file at "path", by exclusively creating a sibling lock file.
+func lockFile(path string) (*fileLock, error) {
+	lockPath := path + ".lock"
+	nonce, err := randHex(16)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(fileLockTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, err := f.WriteString(nonce)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(lockPath)
+				return nil, fmt.Errorf("writing lock file: %w", err)
+			}
+			l := &fileLock{path: lockPath, nonce: nonce}
+			// Another process judging the former lock file stale might have replaced the new one meanwhile.
+			if err := l.check(); err != nil {
+				return nil, err
+			}
+			return l, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("creating lock file: %w", err)
+		}
+		if fi, err := os.Stat(lockPath); err == nil && time.Since(fi.ModTime()) > fileLockStaleAge {
+			removeStaleLock(lockPath, fi)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for the lock file %s, remove it if no other process is using it", lockPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// check returns an error if the lock file is no longer owned by this lock, e.g. it was removed as stale by another
+// process while this one was stuck, in which case the file must not be written.
+func (l *fileLock) check() error {
+	b, err := ioutil.ReadFile(l.path)
+	if err != nil || string(b) != l.nonce {
+		return fmt.Errorf("the lock file %s was taken over by another process", l.path)
+	}
+	return nil
+}
+
+// unlock releases the lock, the lock file is left alone if it is no longer owned by this lock.
+func (l *fileLock) unlock() error {
+	if l.check() != nil {
+		return nil
+	}
+	return os.Remove(l.path)
+}
+
+// removeStaleLock removes the lock file at lockPath, if it is still the stale one described by "stale".
+// Another process might have replaced the stale lock with a new one since it was judged stale, hence the lock file is
+// moved aside atomically first, and moved back unless it turns out to be the stale one.
+func removeStaleLock(lockPath string, stale os.FileInfo) {
+	asidePath := fmt.Sprintf("%s.stale.%d.%d", lockPath, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(lockPath, asidePath); err != nil {
+		// E.g. another process has removed the stale lock already.
+		return
+	}
+	if fi, err := os.Stat(asidePath); err == nil && !os.SameFile(fi, stale) {
+		// The link doesn't replace the lock taken by yet another process meanwhile, if any.
+		if err := os.Link(asidePath, lockPath); err != nil {
+			log.Printf("[WARN] restoring the lock file %s moved aside as stale: %v", lockPath, err)
+		}
+	}
+	os.Remove(asidePath)
+}
+
+// writeFileAtomic writes data into the file at "path" via a temporary file that is renamed afterwards,
+// so that the readers never see a partially written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
+
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -7,6 +7,8 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/hashicorp/go-retryablehttp"
 )
@@ -23,6 +25,16 @@ func NewRequestWithContext(ctx context.Context, method, url string, body io.Read
 	return retryablehttp.FromRequest(req)
 }
 
+// NewFormRequestWithContext creates a POST request whose body is the form encoded "body".
+func NewFormRequestWithContext(ctx context.Context, url string, body url.Values) (*retryablehttp.Request, error) {
+	req, err := NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(body.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
 // Do will send a general HTTP request and unmarshal the response into `outputPtr`.
 // It returns error if the response status code is not 200.
 func (client *HTTPClient) Do(req *retryablehttp.Request, outputPtr interface{}) error {
@@ -0,0 +1,128 @@
+package msauth
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// loopbackServer is a local HTTP server listening on the loopback redirect URL, which receives the authorization
+// response of the authorization code flow.
+type loopbackServer struct {
+	listener net.Listener
+	server   *http.Server
+	path     string
+	// redirectURL is the redirect URL with the actual listening port, which differs from the configured one
+	// if an ephemeral port is requested.
+	redirectURL string
+	// done is closed once the server stops serving, with the error (if any) recorded in err.
+	done chan struct{}
+	err  error
+
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+// newLoopbackServer creates a server listening on the host and port of the redirect URL.
+// If the port is absent or 0 (e.g. "http://localhost"), an ephemeral port is allocated.
+func newLoopbackServer(redirectURL string) (*loopbackServer, error) {
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing redirect URL: %w", err)
+	}
+	if u.Scheme != "http" {
+		return nil, fmt.Errorf("redirect URL %q is not a http URL", redirectURL)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "0"
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return nil, fmt.Errorf("listening on the redirect URL: %w", err)
+	}
+	if port == "0" {
+		u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(listener.Addr().(*net.TCPAddr).Port))
+	}
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	return &loopbackServer{
+		listener:    listener,
+		server:      &http.Server{},
+		path:        path,
+		redirectURL: u.String(),
+		done:        make(chan struct{}),
+	}, nil
+}
+
+// serve starts serving the handler at the path of the redirect URL in background.
+func (s *loopbackServer) serve(handler http.HandlerFunc) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(s.path, func(w http.ResponseWriter, r *http.Request) {
+		// The pattern ending with "/" matches the whole subtree, while other requests (e.g. "/favicon.ico") are not
+		// the authorization response.
+		if r.URL.Path != s.path {
+			http.NotFound(w, r)
+			return
+		}
+		handler(w, r)
+	})
+	s.server.Handler = mux
+	go func() {
+		if err := s.server.Serve(s.listener); err != http.ErrServerClosed {
+			s.err = fmt.Errorf("serving the redirect URL: %w", err)
+		}
+		close(s.done)
+	}()
+}
+
+// shutdown stops the server, while waiting for the in-flight response (e.g. the success page) to be written.
+// It is safe to be called multiple times.
+func (s *loopbackServer) shutdown() error {
+	s.shutdownOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.server.Shutdown(ctx); err != nil {
+			s.server.Close()
+			s.shutdownErr = err
+			return
+		}
+		// The listener is not closed by Shutdown if the server has never served.
+		s.listener.Close()
+	})
+	return s.shutdownErr
+}
+
+var loopbackPage = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<body>
+{{- if . }}
+<p><b>Failed to log in!</b></p>
+<p>{{ . }}</p>
+{{- else }}
+<p><b>You have successfully logged in!</b></p>
+{{- end }}
+You can close this window now.
+</body>
+</html>
+`))
+
+// writeLoopbackPage writes the page telling the user the result of the login.
+func writeLoopbackPage(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	var msg string
+	if err != nil {
+		msg = err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	loopbackPage.Execute(w, msg)
+}
@@ -0,0 +1,27 @@
+package msauth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// pkce is the Proof Key for Code Exchange as defined in https://tools.ietf.org/html/rfc7636,
+// which binds the authorization code to the client that initiated the authorization request.
+type pkce struct {
+	verifier string
+}
+
+func newPKCE() (*pkce, error) {
+	// 32 octets results in a 43 characters code verifier, which is the minimum length allowed.
+	verifier, err := randBase64URL(32)
+	if err != nil {
+		return nil, err
+	}
+	return &pkce{verifier: verifier}, nil
+}
+
+// challenge returns the S256 code challenge of the code verifier.
+func (p *pkce) challenge() string {
+	sum := sha256.Sum256([]byte(p.verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
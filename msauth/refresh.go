@@ -0,0 +1,76 @@
+package msauth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// refreshTokenSource is an oauth2.TokenSource that redeems the refresh token for a new token.
+// Different from the one returned by oauth2.Config.TokenSource, it authenticates the client by a ClientCredential,
+// which allows confidential clients using certificate.
+type refreshTokenSource struct {
+	client       *HTTPClient
+	config       *oauth2.Config
+	credential   ClientCredential
+	refreshToken string
+}
+
+func (s *refreshTokenSource) Token() (*oauth2.Token, error) {
+	return s.token("")
+}
+
+func (s *refreshTokenSource) TokenWithClaims(claims string) (*oauth2.Token, error) {
+	return s.token(claims)
+}
+
+func (s *refreshTokenSource) token(claims string) (*oauth2.Token, error) {
+	if s.refreshToken == "" {
+		return nil, fmt.Errorf("token expired and refresh token is not set")
+	}
+	body := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {s.config.ClientID},
+		"scope":         {strings.Join(oidcScopes(s.config.Scopes), " ")},
+		"refresh_token": {s.refreshToken},
+	}
+	if err := addClientCredential(body, s.credential, s.config.ClientID, s.config.Endpoint.TokenURL); err != nil {
+		return nil, err
+	}
+	if err := addClaims(body, claims); err != nil {
+		return nil, err
+	}
+
+	// The token source outlives the context used to obtain it, hence it uses its own context.
+	req, err := NewFormRequestWithContext(context.Background(), s.config.Endpoint.TokenURL, body)
+	if err != nil {
+		return nil, err
+	}
+	token, tokenerr, err := s.client.DoToken(req)
+	if err != nil {
+		return nil, fmt.Errorf("refreshing token: %w", err)
+	}
+	if tokenerr != nil {
+		return nil, fmt.Errorf("refreshing token: %s", tokenerr.String())
+	}
+
+	t := token.ToOauth2Token()
+	// The refresh token is not necessarily rotated, in which case keep using the current one.
+	if t.RefreshToken == "" {
+		t.RefreshToken = s.refreshToken
+	}
+	s.refreshToken = t.RefreshToken
+	return t, nil
+}
+
+func newRefreshTokenSource(client *HTTPClient, config *oauth2.Config, credential ClientCredential, t *oauth2.Token) ClaimsTokenSource {
+	return newReuseTokenSource(t, &refreshTokenSource{
+		client:       client,
+		config:       config,
+		credential:   credential,
+		refreshToken: t.RefreshToken,
+	})
+}
@@ -13,16 +13,22 @@ type Token struct {
 	TokenType    string `json:"token_type"`
 	ExpiresIn    int    `json:"expires_in"` // "expires_in" is defined as RECOMMENDED, while in MSAUTH it is always returned, hence defined as `int`
 	RefreshToken string `json:"refresh_token"`
+	// IDToken is only returned if the "openid" scope is requested.
+	IDToken string `json:"id_token"`
 }
 
 func (t Token) ToOauth2Token() *oauth2.Token {
 	expiry := time.Now().Add(time.Second * time.Duration(t.ExpiresIn))
-	return &oauth2.Token{
+	token := &oauth2.Token{
 		AccessToken:  t.AccessToken,
 		TokenType:    t.TokenType,
 		RefreshToken: t.RefreshToken,
 		Expiry:       expiry,
 	}
+	if t.IDToken != "" {
+		token = token.WithExtra(map[string]interface{}{"id_token": t.IDToken})
+	}
+	return token
 }
 
 const (
@@ -39,6 +45,10 @@ const (
 	TokenErrorSlowDown             = "slow_down"
 	TokenErrorAccessDenied         = "access_denied"
 	TokenErrorExpiredToken         = "expired_token"
+
+	// Microsoft identity platform specific device flow error code
+	// (See https://docs.microsoft.com/en-us/azure/active-directory/develop/v2-oauth2-device-code#expected-errors)
+	TokenErrorAuthorizationDeclined = "authorization_declined"
 )
 
 type TokenError struct {
@@ -0,0 +1,114 @@
+package msauth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// ContextTokenSource is an oauth2.TokenSource whose token can be obtained under a context, e.g. the one of the request
+// to authorize, which aborts obtaining the token once it is done.
+type ContextTokenSource interface {
+	oauth2.TokenSource
+
+	TokenWithContext(ctx context.Context) (*oauth2.Token, error)
+}
+
+// TokenWithContext obtains the token from the token source under ctx if it is a ContextTokenSource, otherwise ctx is
+// ignored.
+func TokenWithContext(ctx context.Context, ts oauth2.TokenSource) (*oauth2.Token, error) {
+	if cts, ok := ts.(ContextTokenSource); ok {
+		return cts.TokenWithContext(ctx)
+	}
+	return ts.Token()
+}
+
+// Transport is an http.RoundTripper authorizing the requests by the token source, similar to oauth2.Transport.
+// If the token source is a ContextTokenSource, the token is obtained under the context of the request.
+// Additionally, if the token source is a ClaimsTokenSource, it handles the claims challenge of Continuous Access
+// Evaluation, by obtaining a new token satisfying the challenged claims and replaying the request once.
+type Transport struct {
+	Source oauth2.TokenSource
+
+	// Base is the underlying RoundTripper. If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := TokenWithContext(req.Context(), t.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	// The request body is buffered to be replayed, unless it can be got again.
+	getBody := req.GetBody
+	if req.Body != nil && req.Body != http.NoBody && getBody == nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		getBody = func() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(b)), nil }
+		if req, err = withBody(req, getBody); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := t.base().RoundTrip(authorizedRequest(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	claims, ok := parseClaimsChallenge(resp.Header.Values("WWW-Authenticate"))
+	if !ok {
+		return resp, nil
+	}
+	source, ok := t.Source.(ClaimsTokenSource)
+	if !ok {
+		return resp, nil
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	log.Printf("[INFO] obtaining a new token for the claims challenge of %s %s", req.Method, req.URL)
+	if token, err = source.TokenWithClaims(claims); err != nil {
+		return nil, fmt.Errorf("obtaining token for the claims challenge: %w", err)
+	}
+	if getBody != nil {
+		if req, err = withBody(req, getBody); err != nil {
+			return nil, err
+		}
+	}
+	return t.base().RoundTrip(authorizedRequest(req, token))
+}
+
+// withBody returns a shallow copy of the request with a new body got from getBody.
+func withBody(req *http.Request, getBody func() (io.ReadCloser, error)) (*http.Request, error) {
+	body, err := getBody()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Body = body
+	req.GetBody = getBody
+	return req, nil
+}
+
+// authorizedRequest returns a copy of the request with the token set, as a RoundTripper must not modify the request.
+func authorizedRequest(req *http.Request, token *oauth2.Token) *http.Request {
+	req = req.Clone(req.Context())
+	token.SetAuthHeader(req)
+	return req
+}
@@ -0,0 +1,146 @@
+package msauth_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/magodo/terraform-provider-outlook/msauth"
+	"golang.org/x/oauth2"
+)
+
+const testClaimsChallenge = `{"access_token":{"nbf":{"essential":true,"value":"1604106651"}}}`
+
+// claimsTokenSource issues the token "old", until a token satisfying the claims challenge is requested.
+type claimsTokenSource struct {
+	claims []string
+}
+
+func (s *claimsTokenSource) Token() (*oauth2.Token, error) {
+	return &oauth2.Token{AccessToken: "old"}, nil
+}
+
+func (s *claimsTokenSource) TokenWithClaims(claims string) (*oauth2.Token, error) {
+	s.claims = append(s.claims, claims)
+	return &oauth2.Token{AccessToken: "new"}, nil
+}
+
+// newTestGraphServer starts a resource server, which challenges the token "old" with the claims challenge, and echos
+// the request body for the token "new".
+func newTestGraphServer(t *testing.T, challenge string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer old":
+			w.Header().Set("WWW-Authenticate", challenge)
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": {"code": "InvalidAuthenticationToken"}}`))
+		case "Bearer new":
+			b, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Error(err)
+			}
+			w.Write(b)
+		default:
+			t.Errorf("unexpected authorization header %q", r.Header.Get("Authorization"))
+		}
+	}))
+}
+
+func TestTransport_claimsChallenge(t *testing.T) {
+	challenge := `Bearer realm="", authorization_uri="https://login.microsoftonline.com/common/oauth2/authorize", error="insufficient_claims", claims="` +
+		base64.StdEncoding.EncodeToString([]byte(testClaimsChallenge)) + `"`
+	server := newTestGraphServer(t, challenge)
+	defer server.Close()
+
+	source := &claimsTokenSource{}
+	client := &http.Client{Transport: &msauth.Transport{Source: source}}
+
+	// The body without GetBody is buffered to be replayed.
+	req, err := http.NewRequest(http.MethodPost, server.URL, ioutil.NopCloser(strings.NewReader("body")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(b) != "body" {
+		t.Fatalf("expect the request to be replayed, got %d: %s", resp.StatusCode, b)
+	}
+	if len(source.claims) != 1 || source.claims[0] != testClaimsChallenge {
+		t.Fatalf("expect the claims challenge to be requested once, got %v", source.claims)
+	}
+}
+
+func TestTransport_noClaimsChallenge(t *testing.T) {
+	server := newTestGraphServer(t, `Bearer realm="", error="invalid_token"`)
+	defer server.Close()
+
+	source := &claimsTokenSource{}
+	client := &http.Client{Transport: &msauth.Transport{Source: source}}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expect the unauthorized response to be returned, got %d", resp.StatusCode)
+	}
+	if len(source.claims) != 0 {
+		t.Fatalf("expect no claims challenge to be requested, got %v", source.claims)
+	}
+}
+
+func TestClientCredentialClient_claims(t *testing.T) {
+	var claims []string
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		claims = append(claims, r.PostForm.Get("claims"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "at", "token_type": "Bearer", "expires_in": 3600}`))
+	}))
+	defer tokenServer.Close()
+
+	authority := msauth.Authority{Host: tokenServer.URL, TenantID: "tenant"}
+	ts, err := msauth.NewClientCredentialClient(authority, "client", msauth.ClientSecret("secret"), "https://graph.microsoft.com/.default").ObtainTokenSource(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cts, ok := ts.(msauth.ClaimsTokenSource)
+	if !ok {
+		t.Fatal("expect the token source to support claims challenges")
+	}
+	if _, err := cts.TokenWithClaims(testClaimsChallenge); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(claims) != 2 {
+		t.Fatalf("expect 2 token requests, got %d", len(claims))
+	}
+	// Every token request advertises the client capabilities, merged with the claims challenge (if any).
+	for i, expect := range []string{
+		`{"access_token":{"xms_cc":{"values":["CP1"]}}}`,
+		`{"access_token":{"nbf":{"essential":true,"value":"1604106651"},"xms_cc":{"values":["CP1"]}}}`,
+	} {
+		// Re-marshal to sort the keys.
+		var actual interface{}
+		if err := json.Unmarshal([]byte(claims[i]), &actual); err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := json.Marshal(actual); string(b) != expect {
+			t.Fatalf("expect claims %s, got %s", expect, claims[i])
+		}
+	}
+}
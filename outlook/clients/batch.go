@@ -0,0 +1,261 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	msgraph "github.com/yaegashi/msgraph.go/v1.0"
+)
+
+// MaxBatchRequests is the maximum number of the requests in a JSON batch.
+const MaxBatchRequests = 20
+
+// BatchRequest is an individual request of a JSON batch.
+// (See https://docs.microsoft.com/en-us/graph/json-batching)
+type BatchRequest struct {
+	// ID is unique among the requests sent together.
+	ID     string `json:"id"`
+	Method string `json:"method"`
+	// URL is relative to the API version, see Client.BatchURL.
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    interface{}       `json:"body,omitempty"`
+	// DependsOn are the IDs of the preceding requests, which have to succeed before this request is executed.
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// BatchResponse is the response of an individual request of a JSON batch.
+type BatchResponse struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// Err returns the error of a failed response, in the same form as the one of the individual requests.
+func (r BatchResponse) Err() error {
+	if r.Status < 400 {
+		return nil
+	}
+	resp := &http.Response{
+		Status:     fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status)),
+		StatusCode: r.Status,
+	}
+	errResp := &msgraph.ErrorResponse{Response: resp}
+	if err := json.Unmarshal(r.Body, errResp); err != nil || errResp.ErrorObject.Code == "" {
+		return fmt.Errorf("%s: %s", resp.Status, string(r.Body))
+	}
+	return errResp
+}
+
+// retryable tells whether the individual request is throttled or failed transiently, in which case it was not executed.
+func (r BatchResponse) retryable() bool {
+	switch r.Status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return r.Status >= 400 && r.Status < 500 && isMailboxConcurrencyErrorBody(r.Body)
+}
+
+// BatchURL returns the URL of a request builder (e.g. "c.MailFolders.ID(id).URL()") relative to the API version, which
+// is used as the BatchRequest.URL.
+func (c *Client) BatchURL(builderURL string) string {
+	return strings.TrimPrefix(builderURL, c.baseURL)
+}
+
+// Batch sends the requests via JSON batching, up to MaxBatchRequests requests per batch, and returns the responses in
+// the order of the requests. The requests can only depend on the preceding ones, which are kept in order across the
+// batches. A request whose dependency failed is responded with 424 (Failed Dependency) without being sent.
+// The individual requests throttled or failed transiently are retried as configured by the "retry" of the Client, so
+// are the batches throttled as a whole. The failures of the individual requests are reported by BatchResponse.Err,
+// while the returned error is only about the batches themselves.
+func (c *Client) Batch(ctx context.Context, requests []BatchRequest) ([]BatchResponse, error) {
+	index := map[string]int{}
+	for i, req := range requests {
+		if _, ok := index[req.ID]; ok {
+			return nil, fmt.Errorf("duplicate batch request ID %q", req.ID)
+		}
+		for _, dep := range req.DependsOn {
+			if _, ok := index[dep]; !ok {
+				return nil, fmt.Errorf("batch request %q depends on %q, which is not one of its preceding requests", req.ID, dep)
+			}
+		}
+		index[req.ID] = i
+	}
+
+	responses := make([]BatchResponse, len(requests))
+	done := make([]bool, len(requests))
+	for start := 0; start < len(requests); start += MaxBatchRequests {
+		end := start + MaxBatchRequests
+		if end > len(requests) {
+			end = len(requests)
+		}
+
+		pending := make([]int, 0, end-start)
+		for i := start; i < end; i++ {
+			pending = append(pending, i)
+		}
+		for attempt := 0; len(pending) != 0; attempt++ {
+			// The dependencies out of the pending requests are done, only the failed ones matter.
+			var batch []BatchRequest
+			inBatch := map[string]bool{}
+			for _, i := range pending {
+				req := requests[i]
+				var deps []string
+				var failedDep string
+				for _, dep := range req.DependsOn {
+					if inBatch[dep] {
+						deps = append(deps, dep)
+						continue
+					}
+					if j := index[dep]; done[j] && responses[j].Status >= 400 {
+						failedDep = dep
+					}
+				}
+				if failedDep != "" {
+					body, _ := json.Marshal(map[string]interface{}{
+						"error": map[string]string{
+							"code":    "FailedDependency",
+							"message": fmt.Sprintf("The dependent request %q failed.", failedDep),
+						},
+					})
+					responses[i] = BatchResponse{ID: req.ID, Status: http.StatusFailedDependency, Body: body}
+					continue
+				}
+				req.DependsOn = deps
+				batch = append(batch, req)
+				inBatch[req.ID] = true
+			}
+
+			var batchResponses []BatchResponse
+			if len(batch) != 0 {
+				var err error
+				batchResponses, err = c.sendBatch(ctx, batch)
+				if err != nil {
+					return nil, err
+				}
+			}
+			for _, resp := range batchResponses {
+				i, ok := index[resp.ID]
+				if !ok || !inBatch[resp.ID] {
+					return nil, fmt.Errorf("unexpected batch response ID %q", resp.ID)
+				}
+				responses[i] = resp
+			}
+
+			// Retry the throttled requests, together with the ones failed on them.
+			var retry []int
+			var retryAfter string
+			var maxRetryAfter time.Duration
+			for _, i := range pending {
+				resp := responses[i]
+				if resp.ID == "" {
+					return nil, fmt.Errorf("missing the batch response of %q", requests[i].ID)
+				}
+				if resp.retryable() {
+					retry = append(retry, i)
+					if d, ok := parseRetryAfter(resp.Headers["Retry-After"]); ok && d >= maxRetryAfter {
+						retryAfter, maxRetryAfter = resp.Headers["Retry-After"], d
+					}
+					continue
+				}
+				if resp.Status == http.StatusFailedDependency && dependsOnAny(requests[i], requests, retry) {
+					retry = append(retry, i)
+					continue
+				}
+				done[i] = true
+			}
+			if len(retry) == 0 {
+				break
+			}
+			wait := c.retry.backoff(attempt, retryAfter)
+			if attempt >= c.retry.MaxRetries {
+				for _, i := range retry {
+					done[i] = true
+				}
+				break
+			}
+			// Give up once the retry can't be done before the deadline (e.g. the timeout of the resource).
+			if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+				for _, i := range retry {
+					done[i] = true
+				}
+				break
+			}
+			log.Printf("[INFO] retrying %d throttled batch requests in %s (%d/%d)", len(retry), wait, attempt+1, c.retry.MaxRetries)
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+			for _, i := range retry {
+				responses[i] = BatchResponse{}
+			}
+			pending = retry
+		}
+		log.Printf("[INFO] batch requests done: %d/%d", end, len(requests))
+	}
+	return responses, nil
+}
+
+// dependsOnAny tells whether the request depends on any of the requests specified by the indexes.
+func dependsOnAny(req BatchRequest, requests []BatchRequest, indexes []int) bool {
+	for _, dep := range req.DependsOn {
+		for _, i := range indexes {
+			if requests[i].ID == dep {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sendBatch sends a single JSON batch.
+func (c *Client) sendBatch(ctx context.Context, requests []BatchRequest) ([]BatchResponse, error) {
+	b, err := json.Marshal(struct {
+		Requests []BatchRequest `json:"requests"`
+	}{requests})
+	if err != nil {
+		return nil, err
+	}
+	// The batch as a whole is only throttled (i.e. 429) before any individual request is executed, hence it is only
+	// retried then. Otherwise (e.g. 503), some individual requests may have been executed, which are left to the retries
+	// of the individual requests by the caller.
+	req, err := http.NewRequestWithContext(withRetryThrottled(ctx), http.MethodPost, c.baseURL+"/$batch", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		errResp := &msgraph.ErrorResponse{Response: resp}
+		if err := json.Unmarshal(b, errResp); err != nil {
+			return nil, fmt.Errorf("%s: %s", resp.Status, string(b))
+		}
+		return nil, errResp
+	}
+	var body struct {
+		Responses []BatchResponse `json:"responses"`
+	}
+	if err := json.Unmarshal(b, &body); err != nil {
+		return nil, fmt.Errorf("decoding batch response: %w", err)
+	}
+	return body.Responses, nil
+}
@@ -0,0 +1,193 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// newTestBatchServer starts a MS Graph server, which responds the n-th (starting from 0) JSON batch by "respond", and
+// records the IDs of the requests of each batch into "calls".
+func newTestBatchServer(t *testing.T, calls *[][]string, respond func(n int, requests []BatchRequest) (int, []BatchResponse)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1.0/$batch" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body struct {
+			Requests []BatchRequest `json:"requests"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		var ids []string
+		for _, req := range body.Requests {
+			ids = append(ids, req.ID)
+		}
+		*calls = append(*calls, ids)
+
+		status, responses := respond(len(*calls)-1, body.Requests)
+		w.Header().Set("Content-Type", "application/json")
+		if status != http.StatusOK {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error": {"code": "ServiceUnavailable", "message": "Try again later."}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"responses": responses})
+	}))
+}
+
+func TestClient_Batch(t *testing.T) {
+	throttled := func(id string) BatchResponse {
+		return BatchResponse{ID: id, Status: http.StatusTooManyRequests, Headers: map[string]string{"Retry-After": "0"}}
+	}
+	requests := []BatchRequest{
+		{ID: "1", Method: http.MethodGet, URL: "/me/mailFolders/inbox"},
+		{ID: "2", Method: http.MethodPost, URL: "/me/mailFolders", Body: map[string]string{"displayName": "foo"}, DependsOn: []string{"1"}},
+	}
+
+	cases := []struct {
+		name     string
+		requests []BatchRequest
+		respond  func(n int, requests []BatchRequest) (int, []BatchResponse)
+		status   []int
+		calls    [][]string
+		err      bool
+	}{
+		{
+			name:     "partial failure",
+			requests: requests[:1],
+			respond: func(int, []BatchRequest) (int, []BatchResponse) {
+				return http.StatusOK, []BatchResponse{{ID: "1", Status: http.StatusNotFound}}
+			},
+			status: []int{http.StatusNotFound},
+			calls:  [][]string{{"1"}},
+		},
+		{
+			// Only the throttled request is retried.
+			name:     "item throttled",
+			requests: []BatchRequest{requests[0], {ID: "3", Method: http.MethodGet, URL: "/me"}},
+			respond: func(n int, requests []BatchRequest) (int, []BatchResponse) {
+				if n == 0 {
+					return http.StatusOK, []BatchResponse{throttled("1"), {ID: "3", Status: http.StatusOK}}
+				}
+				return http.StatusOK, []BatchResponse{{ID: "1", Status: http.StatusOK}}
+			},
+			status: []int{http.StatusOK, http.StatusOK},
+			calls:  [][]string{{"1", "3"}, {"1"}},
+		},
+		{
+			name:     "item throttled beyond the retries",
+			requests: requests[:1],
+			respond: func(int, []BatchRequest) (int, []BatchResponse) {
+				return http.StatusOK, []BatchResponse{throttled("1")}
+			},
+			status: []int{http.StatusTooManyRequests},
+			calls:  [][]string{{"1"}, {"1"}, {"1"}},
+		},
+		{
+			// The request failed on the throttled dependency is retried together.
+			name:     "dependency throttled",
+			requests: requests,
+			respond: func(n int, requests []BatchRequest) (int, []BatchResponse) {
+				if n == 0 {
+					return http.StatusOK, []BatchResponse{throttled("1"), {ID: "2", Status: http.StatusFailedDependency}}
+				}
+				return http.StatusOK, []BatchResponse{{ID: "1", Status: http.StatusOK}, {ID: "2", Status: http.StatusCreated}}
+			},
+			status: []int{http.StatusOK, http.StatusCreated},
+			calls:  [][]string{{"1", "2"}, {"1", "2"}},
+		},
+		{
+			// The dependency failed is responded by the client, without being sent.
+			name:     "dependency failure",
+			requests: requests,
+			respond: func(n int, requests []BatchRequest) (int, []BatchResponse) {
+				if n == 0 {
+					return http.StatusOK, []BatchResponse{{ID: "1", Status: http.StatusNotFound}, {ID: "2", Status: http.StatusFailedDependency}}
+				}
+				t.Errorf("unexpected batch %d", n)
+				return http.StatusOK, nil
+			},
+			status: []int{http.StatusNotFound, http.StatusFailedDependency},
+			calls:  [][]string{{"1", "2"}},
+		},
+		{
+			// The batch throttled as a whole is not executed at all, which is retried.
+			name:     "batch throttled",
+			requests: requests,
+			respond: func(n int, requests []BatchRequest) (int, []BatchResponse) {
+				if n == 0 {
+					return http.StatusTooManyRequests, nil
+				}
+				return http.StatusOK, []BatchResponse{{ID: "1", Status: http.StatusOK}, {ID: "2", Status: http.StatusCreated}}
+			},
+			status: []int{http.StatusOK, http.StatusCreated},
+			calls:  [][]string{{"1", "2"}, {"1", "2"}},
+		},
+		{
+			// The batch failed as a whole otherwise may be executed partially, which is not resent.
+			name:     "batch unavailable",
+			requests: requests,
+			respond: func(int, []BatchRequest) (int, []BatchResponse) {
+				return http.StatusServiceUnavailable, nil
+			},
+			calls: [][]string{{"1", "2"}},
+			err:   true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var calls [][]string
+			srv := newTestBatchServer(t, &calls, c.respond)
+			defer srv.Close()
+			init := func(context.Context) (oauth2.TokenSource, error) {
+				return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "foo"}), nil
+			}
+			retry := RetryOptions{MaxRetries: 2, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+			client := NewClient(init, nil, srv.URL, "", UserFeature{}, retry, DefaultLimitOptions)
+
+			responses, err := client.Batch(context.Background(), c.requests)
+			if c.err {
+				if err == nil {
+					t.Fatal("expect error, got nil")
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			var status []int
+			for i, resp := range responses {
+				if resp.ID != c.requests[i].ID {
+					t.Fatalf("response %d: expect ID %s, got %s", i, c.requests[i].ID, resp.ID)
+				}
+				status = append(status, resp.Status)
+			}
+			if !reflect.DeepEqual(status, c.status) {
+				t.Fatalf("expect status %v, got %v", c.status, status)
+			}
+			if !reflect.DeepEqual(calls, c.calls) {
+				t.Fatalf("expect batches %v, got %v", c.calls, calls)
+			}
+		})
+	}
+}
+
+func TestClient_Batch_invalid(t *testing.T) {
+	client := NewClient(nil, nil, "https://graph.microsoft.com", "", UserFeature{}, DefaultRetryOptions, DefaultLimitOptions)
+	for name, requests := range map[string][]BatchRequest{
+		"duplicate ID":        {{ID: "1", Method: http.MethodGet, URL: "/me"}, {ID: "1", Method: http.MethodGet, URL: "/me"}},
+		"following dependent": {{ID: "1", Method: http.MethodGet, URL: "/me", DependsOn: []string{"2"}}, {ID: "2", Method: http.MethodGet, URL: "/me"}},
+	} {
+		if _, err := client.Batch(context.Background(), requests); err == nil {
+			t.Errorf("%s: expect an error", name)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package clients
+
+import (
+	"context"
+
+	msgraph "github.com/yaegashi/msgraph.go/v1.0"
+)
+
+// categoryService is the CategoryService backed by MS Graph.
+type categoryService struct {
+	builder *msgraph.OutlookUserMasterCategoriesCollectionRequestBuilder
+}
+
+func (s *categoryService) List(ctx context.Context) ([]msgraph.OutlookCategory, error) {
+	return s.builder.Request().Get(ctx)
+}
+
+func (s *categoryService) Get(ctx context.Context, id string) (*msgraph.OutlookCategory, error) {
+	return s.builder.ID(id).Request().Get(ctx)
+}
+
+func (s *categoryService) Create(ctx context.Context, category *msgraph.OutlookCategory) (*msgraph.OutlookCategory, error) {
+	return s.builder.Request().Add(ctx, category)
+}
+
+func (s *categoryService) Update(ctx context.Context, id string, category *msgraph.OutlookCategory) error {
+	return s.builder.ID(id).Request().Update(WithRetrySafe(ctx), category)
+}
+
+func (s *categoryService) Delete(ctx context.Context, id string) error {
+	return s.builder.ID(id).Request().Delete(ctx)
+}
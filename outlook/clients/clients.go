@@ -1,25 +1,86 @@
 package clients
 
 import (
+	"net/http"
+	"net/url"
+
+	"github.com/magodo/terraform-provider-outlook/msauth"
 	msgraph "github.com/yaegashi/msgraph.go/v1.0"
+	"golang.org/x/oauth2"
 )
 
 type Client struct {
 	UserFeature
-	MailFolders  *msgraph.UserMailFoldersCollectionRequestBuilder
-	MessageRules *msgraph.MailFolderMessageRulesCollectionRequestBuilder
-	Categories   *msgraph.OutlookUserMasterCategoriesCollectionRequestBuilder
+	User         *msgraph.UserRequestBuilder
+	MailFolders  MailFolderService
+	MessageRules MessageRuleService
+	Categories   CategoryService
+
+	tokenSource oauth2.TokenSource
+	httpClient  *http.Client
+	// baseURL is the URL of MS Graph with the API version.
+	baseURL string
+	retry   RetryOptions
+}
+
+// TokenClaims returns the claims of the current access token.
+func (c *Client) TokenClaims() (*msauth.Claims, error) {
+	t, err := c.tokenSource.Token()
+	if err != nil {
+		return nil, err
+	}
+	return msauth.AccessTokenClaims(t)
 }
 
-func NewClient(b msgraph.BaseRequestBuilder, feature UserFeature) *Client {
-	b.SetURL(b.URL() + "/me")
+// NewClient creates a Client authenticated by the token source initialized by "init", targeting the mailbox of the
+// specified user (either the object ID or the user principal name) in the MS Graph at graphEndpoint (without the API
+// version). If readInit is not nil, it initializes the token source of the read requests (e.g. of the read-only scopes),
+// until the first write request initializes the one of "init", which is used by all the requests afterwards.
+// If userID is empty, the signed-in user (i.e. "/me") is targeted, which is only available for delegated permissions.
+// The token source is initialized by the first request (i.e. the login is deferred until MS Graph is called) with the
+// context of that request, and its error is returned by every request.
+// The requests rejected by the claims challenges of Continuous Access Evaluation are replayed once with a new token, if
+// the token source supports it (see msauth.ClaimsTokenSource).
+// The requests throttled or failed transiently are retried as configured by "retry".
+// The requests to the mailbox are limited by "limit", which is shared by all the Clients targeting the same mailbox
+// (see mailboxKey).
+func NewClient(init, readInit TokenSourceFunc, graphEndpoint string, userID string, feature UserFeature, retry RetryOptions, limit LimitOptions) *Client {
+	baseURL := graphEndpoint + "/v1.0"
+	mailboxURL := baseURL
+	if userID == "" {
+		mailboxURL += "/me"
+	} else {
+		mailboxURL += "/users/" + url.PathEscape(userID)
+	}
+
+	// The retries happen out of the limits, so that the backoff doesn't take the slot of the other requests.
+	ts := &readWriteTokenSource{write: &lazyTokenSource{init: init}}
+	if readInit != nil {
+		ts.read = &lazyTokenSource{init: readInit}
+	}
+	transport := &retryTransport{
+		base: &initTransport{
+			base:   &limitTransport{baseURL: baseURL, userID: userID, options: limit},
+			source: ts,
+		},
+		options: retry,
+	}
+	httpClient := &http.Client{Transport: transport}
+	b := msgraph.NewClient(httpClient).BaseRequestBuilder
+	b.SetURL(mailboxURL)
 	userClient := msgraph.UserRequestBuilder{BaseRequestBuilder: b}
 	outlookClient := msgraph.OutlookUserRequestBuilder{BaseRequestBuilder: b}
 	outlookClient.SetURL(outlookClient.URL() + "/outlook")
-	return &Client{
+	c := &Client{
+		tokenSource:  ts,
+		httpClient:   httpClient,
+		baseURL:      baseURL,
+		retry:        retry,
 		UserFeature:  feature,
-		MailFolders:  userClient.MailFolders(),
-		MessageRules: userClient.MailFolders().ID("inbox").MessageRules(),
-		Categories:   outlookClient.MasterCategories(),
+		User:         &userClient,
+		MessageRules: &messageRuleService{builder: userClient.MailFolders().ID("inbox").MessageRules()},
+		Categories:   &categoryService{builder: outlookClient.MasterCategories()},
 	}
+	c.MailFolders = &mailFolderService{client: c, builder: userClient.MailFolders()}
+	return c
 }
@@ -0,0 +1,123 @@
+package clientstest
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/magodo/terraform-provider-outlook/outlook/clients"
+	msgraph "github.com/yaegashi/msgraph.go/v1.0"
+)
+
+// CategoryService is an in-memory clients.CategoryService.
+type CategoryService struct {
+	// Errors are returned by the methods of the same name (e.g. "Create"), instead of doing the work.
+	Errors map[string]error
+
+	mu         sync.Mutex
+	categories map[string]*msgraph.OutlookCategory
+}
+
+var _ clients.CategoryService = &CategoryService{}
+
+// NewCategoryService creates a CategoryService without any category.
+func NewCategoryService() *CategoryService {
+	return &CategoryService{
+		Errors:     map[string]error{},
+		categories: map[string]*msgraph.OutlookCategory{},
+	}
+}
+
+func (s *CategoryService) List(ctx context.Context) ([]msgraph.OutlookCategory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Errors["List"]; err != nil {
+		return nil, err
+	}
+	var categories []msgraph.OutlookCategory
+	for _, category := range s.categories {
+		var c msgraph.OutlookCategory
+		clone(&c, category)
+		categories = append(categories, c)
+	}
+	sort.Slice(categories, func(i, j int) bool { return *categories[i].DisplayName < *categories[j].DisplayName })
+	return categories, nil
+}
+
+func (s *CategoryService) Get(ctx context.Context, id string) (*msgraph.OutlookCategory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Errors["Get"]; err != nil {
+		return nil, err
+	}
+	category, ok := s.categories[id]
+	if !ok {
+		return nil, notFoundError()
+	}
+	var c msgraph.OutlookCategory
+	clone(&c, category)
+	return &c, nil
+}
+
+func (s *CategoryService) Create(ctx context.Context, category *msgraph.OutlookCategory) (*msgraph.OutlookCategory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Errors["Create"]; err != nil {
+		return nil, err
+	}
+	if category.DisplayName == nil || *category.DisplayName == "" {
+		return nil, NewError(http.StatusBadRequest, "ErrorInvalidArgument", "The category display name can't be empty.")
+	}
+	for _, c := range s.categories {
+		if strings.EqualFold(*c.DisplayName, *category.DisplayName) {
+			return nil, NewError(http.StatusConflict, "ErrorDuplicateCategory", "A category with the specified name already exists.")
+		}
+	}
+
+	var c msgraph.OutlookCategory
+	clone(&c, category)
+	id := newGUID()
+	c.ID = &id
+	if c.Color == nil {
+		color := msgraph.CategoryColorVNone
+		c.Color = &color
+	}
+	s.categories[id] = &c
+
+	var created msgraph.OutlookCategory
+	clone(&created, &c)
+	return &created, nil
+}
+
+func (s *CategoryService) Update(ctx context.Context, id string, category *msgraph.OutlookCategory) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Errors["Update"]; err != nil {
+		return err
+	}
+	c, ok := s.categories[id]
+	if !ok {
+		return notFoundError()
+	}
+	// The display name of a category can't be changed once created.
+	if category.DisplayName != nil && *category.DisplayName != *c.DisplayName {
+		return NewError(http.StatusBadRequest, "ErrorInvalidArgument", "The category display name can't be changed.")
+	}
+	patch(c, category)
+	return nil
+}
+
+func (s *CategoryService) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Errors["Delete"]; err != nil {
+		return err
+	}
+	if _, ok := s.categories[id]; !ok {
+		return notFoundError()
+	}
+	delete(s.categories, id)
+	return nil
+}
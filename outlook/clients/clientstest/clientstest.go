@@ -0,0 +1,105 @@
+// Package clientstest provides the in-memory fakes of the services of clients.Client, for the unit tests of the
+// resources and data sources.
+package clientstest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/magodo/terraform-provider-outlook/outlook/clients"
+	msgraph "github.com/yaegashi/msgraph.go/v1.0"
+)
+
+// Fakes are the fake services of a mailbox.
+type Fakes struct {
+	MailFolders  *MailFolderService
+	MessageRules *MessageRuleService
+	Categories   *CategoryService
+}
+
+// NewFakes creates the Fakes of an empty mailbox, which only has the well-known mail folders.
+func NewFakes() *Fakes {
+	return &Fakes{
+		MailFolders:  NewMailFolderService(),
+		MessageRules: NewMessageRuleService(),
+		Categories:   NewCategoryService(),
+	}
+}
+
+// Client returns a clients.Client backed by the Fakes, which is used as the "meta" of the resources.
+func (f *Fakes) Client() *clients.Client {
+	return &clients.Client{
+		MailFolders:  f.MailFolders,
+		MessageRules: f.MessageRules,
+		Categories:   f.Categories,
+	}
+}
+
+// NewError returns an error in the same form as the one returned by MS Graph, e.g.:
+//
+//	NewError(http.StatusNotFound, "ErrorItemNotFound", "The specified object was not found in the store.")
+func NewError(statusCode int, code, message string) *msgraph.ErrorResponse {
+	return &msgraph.ErrorResponse{
+		ErrorObject: msgraph.ErrorObject{Code: code, Message: message},
+		Response: &http.Response{
+			Status:     fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+			StatusCode: statusCode,
+		},
+	}
+}
+
+func notFoundError() *msgraph.ErrorResponse {
+	return NewError(http.StatusNotFound, "ErrorItemNotFound", "The specified object was not found in the store.")
+}
+
+// newID returns a random ID in the form of the Exchange item IDs, e.g. "AAMkADAwATM0MDAAMS1iNTcwLWI2NTEtMDACLTAwCgBGAAAD...".
+func newID(prefix string, n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return prefix + base64.URLEncoding.EncodeToString(b)
+}
+
+// newGUID returns a random GUID, e.g. "8f1c2d3e-4b5a-4c6d-9e7f-0a1b2c3d4e5f".
+func newGUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// clone deep copies src into dst, so that the stored objects are never shared with the callers.
+func clone(dst, src interface{}) {
+	b, err := json.Marshal(src)
+	if err != nil {
+		panic(err)
+	}
+	if err := json.Unmarshal(b, dst); err != nil {
+		panic(err)
+	}
+}
+
+// patch updates the properties of dst, which are present in src, i.e. the semantics of the PATCH requests of MS Graph.
+func patch(dst, src interface{}) {
+	var dstProps, srcProps map[string]json.RawMessage
+	clone(&dstProps, dst)
+	clone(&srcProps, src)
+	for k, v := range srcProps {
+		if k == "id" {
+			continue
+		}
+		dstProps[k] = v
+	}
+	// Reset dst before decoding, as the decoding merges into the existing values otherwise.
+	v := reflect.ValueOf(dst).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	clone(dst, dstProps)
+}
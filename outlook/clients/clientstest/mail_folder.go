@@ -0,0 +1,286 @@
+package clientstest
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/magodo/terraform-provider-outlook/outlook/clients"
+	msgraph "github.com/yaegashi/msgraph.go/v1.0"
+)
+
+// wellKnownFolders are the display names of the well-known mail folders, keyed by their well-known names.
+var wellKnownFolders = map[string]string{
+	"inbox":        "Inbox",
+	"drafts":       "Drafts",
+	"sentitems":    "Sent Items",
+	"deleteditems": "Deleted Items",
+	"junkemail":    "Junk Email",
+	"archive":      "Archive",
+	"outbox":       "Outbox",
+}
+
+// MailFolderService is an in-memory clients.MailFolderService.
+type MailFolderService struct {
+	// Errors are returned by the methods of the same name (e.g. "Create"), instead of doing the work.
+	Errors map[string]error
+	// MoveErrors are the errors of moving the individual messages, keyed by the message ID.
+	MoveErrors map[string]error
+
+	mu        sync.Mutex
+	root      string
+	wellKnown map[string]string
+	folders   map[string]*msgraph.MailFolder
+	messages  map[string][]string
+}
+
+var _ clients.MailFolderService = &MailFolderService{}
+
+// NewMailFolderService creates a MailFolderService, which only has the well-known mail folders.
+func NewMailFolderService() *MailFolderService {
+	s := &MailFolderService{
+		Errors:     map[string]error{},
+		MoveErrors: map[string]error{},
+		root:       newID("AQMkAD", 60),
+		wellKnown:  map[string]string{},
+		folders:    map[string]*msgraph.MailFolder{},
+		messages:   map[string][]string{},
+	}
+	for name, displayName := range wellKnownFolders {
+		id := s.add(s.root, displayName)
+		s.wellKnown[name] = id
+	}
+	return s
+}
+
+func (s *MailFolderService) add(parentID, displayName string) string {
+	id := newID("AQMkAD", 60)
+	s.folders[id] = &msgraph.MailFolder{
+		Entity:         msgraph.Entity{ID: &id},
+		DisplayName:    &displayName,
+		ParentFolderID: &parentID,
+	}
+	return id
+}
+
+// resolve returns the ID of the folder, which is either the ID or the well-known name.
+func (s *MailFolderService) resolve(id string) (string, bool) {
+	if v, ok := s.wellKnown[strings.ToLower(id)]; ok {
+		id = v
+	}
+	_, ok := s.folders[id]
+	return id, ok
+}
+
+// children returns the child folders of the parent folder, in the order of their display names.
+func (s *MailFolderService) children(parentID string) []msgraph.MailFolder {
+	var folders []msgraph.MailFolder
+	for _, folder := range s.folders {
+		if *folder.ParentFolderID == parentID {
+			var f msgraph.MailFolder
+			clone(&f, folder)
+			folders = append(folders, f)
+		}
+	}
+	sort.Slice(folders, func(i, j int) bool { return *folders[i].DisplayName < *folders[j].DisplayName })
+	return folders
+}
+
+func (s *MailFolderService) List(ctx context.Context, parentID, displayName string) ([]msgraph.MailFolder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Errors["List"]; err != nil {
+		return nil, err
+	}
+	if parentID == "" {
+		parentID = s.root
+	} else {
+		var ok bool
+		if parentID, ok = s.resolve(parentID); !ok {
+			return nil, notFoundError()
+		}
+	}
+	var folders []msgraph.MailFolder
+	for _, folder := range s.children(parentID) {
+		if displayName == "" || *folder.DisplayName == displayName {
+			folders = append(folders, folder)
+		}
+	}
+	return folders, nil
+}
+
+func (s *MailFolderService) Get(ctx context.Context, id string) (*msgraph.MailFolder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Errors["Get"]; err != nil {
+		return nil, err
+	}
+	id, ok := s.resolve(id)
+	if !ok {
+		return nil, notFoundError()
+	}
+	var folder msgraph.MailFolder
+	clone(&folder, s.folders[id])
+	return &folder, nil
+}
+
+func (s *MailFolderService) Create(ctx context.Context, parentID string, folder *msgraph.MailFolder) (*msgraph.MailFolder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Errors["Create"]; err != nil {
+		return nil, err
+	}
+	if parentID == "" {
+		parentID = s.root
+	} else {
+		var ok bool
+		if parentID, ok = s.resolve(parentID); !ok {
+			return nil, notFoundError()
+		}
+	}
+	if folder.DisplayName == nil || *folder.DisplayName == "" {
+		return nil, NewError(http.StatusBadRequest, "ErrorInvalidRequest", "The folder display name can't be empty.")
+	}
+	for _, child := range s.children(parentID) {
+		if strings.EqualFold(*child.DisplayName, *folder.DisplayName) {
+			return nil, NewError(http.StatusConflict, "ErrorFolderExists", "A folder with the specified name already exists.")
+		}
+	}
+	id := s.add(parentID, *folder.DisplayName)
+	var created msgraph.MailFolder
+	clone(&created, s.folders[id])
+	return &created, nil
+}
+
+func (s *MailFolderService) Update(ctx context.Context, id string, folder *msgraph.MailFolder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Errors["Update"]; err != nil {
+		return err
+	}
+	id, ok := s.resolve(id)
+	if !ok {
+		return notFoundError()
+	}
+	patch(s.folders[id], folder)
+	return nil
+}
+
+func (s *MailFolderService) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Errors["Delete"]; err != nil {
+		return err
+	}
+	id, ok := s.resolve(id)
+	if !ok {
+		return notFoundError()
+	}
+	for name, wellKnownID := range s.wellKnown {
+		if wellKnownID == id {
+			return NewError(http.StatusForbidden, "ErrorDeleteDistinguishedFolder", "Distinguished folders cannot be deleted: "+name)
+		}
+	}
+	s.delete(id)
+	return nil
+}
+
+// delete deletes the folder, together with its child folders and messages.
+func (s *MailFolderService) delete(id string) {
+	for _, child := range s.children(id) {
+		s.delete(*child.ID)
+	}
+	delete(s.folders, id)
+	delete(s.messages, id)
+}
+
+func (s *MailFolderService) ListMessageIDs(ctx context.Context, id string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Errors["ListMessageIDs"]; err != nil {
+		return nil, err
+	}
+	id, ok := s.resolve(id)
+	if !ok {
+		return nil, notFoundError()
+	}
+	return append([]string(nil), s.messages[id]...), nil
+}
+
+func (s *MailFolderService) MoveMessages(ctx context.Context, id string, messageIDs []string, destinationID string) ([]error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Errors["MoveMessages"]; err != nil {
+		return nil, err
+	}
+	if _, ok := s.resolve(id); !ok {
+		return nil, notFoundError()
+	}
+	if _, ok := s.resolve(destinationID); !ok {
+		return nil, notFoundError()
+	}
+	errs := make([]error, len(messageIDs))
+	for i, messageID := range messageIDs {
+		_, errs[i] = s.moveMessage(id, messageID, destinationID)
+	}
+	return errs, nil
+}
+
+// MoveMessage moves a single message in the folder to the destination folder, and returns the new ID of the message.
+func (s *MailFolderService) MoveMessage(ctx context.Context, id, messageID, destinationID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Errors["MoveMessage"]; err != nil {
+		return "", err
+	}
+	return s.moveMessage(id, messageID, destinationID)
+}
+
+func (s *MailFolderService) moveMessage(id, messageID, destinationID string) (string, error) {
+	if err := s.MoveErrors[messageID]; err != nil {
+		return "", err
+	}
+	id, ok := s.resolve(id)
+	if !ok {
+		return "", notFoundError()
+	}
+	destinationID, ok = s.resolve(destinationID)
+	if !ok {
+		return "", notFoundError()
+	}
+	if !s.removeMessage(id, messageID) {
+		return "", notFoundError()
+	}
+	// The message gets a new ID once moved to another folder.
+	newMessageID := newID("AAMkAD", 114)
+	s.messages[destinationID] = append(s.messages[destinationID], newMessageID)
+	return newMessageID, nil
+}
+
+func (s *MailFolderService) removeMessage(id, messageID string) bool {
+	for i, v := range s.messages[id] {
+		if v == messageID {
+			s.messages[id] = append(s.messages[id][:i], s.messages[id][i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// AddMessages adds n messages to the folder (the ID or the well-known name), and returns their IDs.
+func (s *MailFolderService) AddMessages(id string, n int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.resolve(id)
+	if !ok {
+		panic("mail folder not found: " + id)
+	}
+	var ids []string
+	for i := 0; i < n; i++ {
+		ids = append(ids, newID("AAMkAD", 114))
+	}
+	s.messages[id] = append(s.messages[id], ids...)
+	return ids
+}
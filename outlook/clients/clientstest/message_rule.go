@@ -0,0 +1,121 @@
+package clientstest
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/magodo/terraform-provider-outlook/outlook/clients"
+	msgraph "github.com/yaegashi/msgraph.go/v1.0"
+)
+
+// MessageRuleService is an in-memory clients.MessageRuleService.
+type MessageRuleService struct {
+	// Errors are returned by the methods of the same name (e.g. "Create"), instead of doing the work.
+	Errors map[string]error
+
+	mu    sync.Mutex
+	rules map[string]*msgraph.MessageRule
+}
+
+var _ clients.MessageRuleService = &MessageRuleService{}
+
+// NewMessageRuleService creates a MessageRuleService without any rule.
+func NewMessageRuleService() *MessageRuleService {
+	return &MessageRuleService{
+		Errors: map[string]error{},
+		rules:  map[string]*msgraph.MessageRule{},
+	}
+}
+
+func (s *MessageRuleService) List(ctx context.Context, displayName string) ([]msgraph.MessageRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Errors["List"]; err != nil {
+		return nil, err
+	}
+	var rules []msgraph.MessageRule
+	for _, rule := range s.rules {
+		if displayName == "" || *rule.DisplayName == displayName {
+			var r msgraph.MessageRule
+			clone(&r, rule)
+			rules = append(rules, r)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return *rules[i].Sequence < *rules[j].Sequence })
+	return rules, nil
+}
+
+func (s *MessageRuleService) Get(ctx context.Context, id string) (*msgraph.MessageRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Errors["Get"]; err != nil {
+		return nil, err
+	}
+	rule, ok := s.rules[id]
+	if !ok {
+		return nil, notFoundError()
+	}
+	var r msgraph.MessageRule
+	clone(&r, rule)
+	return &r, nil
+}
+
+func (s *MessageRuleService) Create(ctx context.Context, rule *msgraph.MessageRule) (*msgraph.MessageRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Errors["Create"]; err != nil {
+		return nil, err
+	}
+	if rule.DisplayName == nil || *rule.DisplayName == "" {
+		return nil, NewError(http.StatusBadRequest, "ErrorInvalidRequest", "The rule display name can't be empty.")
+	}
+	if rule.Sequence == nil || *rule.Sequence < 1 || *rule.Sequence > math.MaxInt16 {
+		return nil, NewError(http.StatusBadRequest, "ErrorInvalidRequest", "The rule sequence is out of range.")
+	}
+
+	var r msgraph.MessageRule
+	clone(&r, rule)
+	id := newID("AQAAA", 6) + "="
+	r.ID = &id
+	if r.IsEnabled == nil {
+		enabled := true
+		r.IsEnabled = &enabled
+	}
+	hasError, readOnly := false, false
+	r.HasError, r.IsReadOnly = &hasError, &readOnly
+	s.rules[id] = &r
+
+	var created msgraph.MessageRule
+	clone(&created, &r)
+	return &created, nil
+}
+
+func (s *MessageRuleService) Update(ctx context.Context, id string, rule *msgraph.MessageRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Errors["Update"]; err != nil {
+		return err
+	}
+	r, ok := s.rules[id]
+	if !ok {
+		return notFoundError()
+	}
+	patch(r, rule)
+	return nil
+}
+
+func (s *MessageRuleService) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Errors["Delete"]; err != nil {
+		return err
+	}
+	if _, ok := s.rules[id]; !ok {
+		return notFoundError()
+	}
+	delete(s.rules, id)
+	return nil
+}
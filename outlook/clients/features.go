@@ -1,5 +1,3 @@
 package clients
 
-type UserFeature struct {
-	MailFolderDeleteParallelism int
-}
+type UserFeature struct{}
@@ -0,0 +1,189 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/magodo/terraform-provider-outlook/msauth"
+)
+
+// LimitOptions limits the requests sent to a mailbox, which is shared by all the provider instances (e.g. the provider
+// aliases) targeting the same mailbox.
+// (See https://docs.microsoft.com/en-us/graph/throttling#outlook-service-limits)
+type LimitOptions struct {
+	// MaxConcurrentRequests is the maximum number of the in-flight requests.
+	MaxConcurrentRequests int
+	// RequestsPerWindow is the maximum number of the requests sent within any Window, 0 means unlimited.
+	RequestsPerWindow int
+	Window            time.Duration
+}
+
+// DefaultLimitOptions are the LimitOptions used by the provider, unless configured otherwise, which conforms to the
+// concurrent requests limit of the Outlook service.
+var DefaultLimitOptions = LimitOptions{
+	MaxConcurrentRequests: 4,
+	Window:                10 * time.Minute,
+}
+
+// mailboxLimiters is the registry of the mailboxLimiter, keyed by the mailbox (see mailboxKey).
+var mailboxLimiters = struct {
+	sync.Mutex
+	m map[string]*mailboxLimiter
+}{m: map[string]*mailboxLimiter{}}
+
+// mailboxLimiter limits the concurrency and the rate of the requests sent to a mailbox.
+type mailboxLimiter struct {
+	key     string
+	options LimitOptions
+	sem     chan struct{}
+
+	mutex sync.Mutex
+	// starts is a ring buffer of the start time of the last RequestsPerWindow requests.
+	starts []time.Time
+	next   int
+}
+
+// mailboxKey identifies the mailbox of the user (either the object ID or the user principal name) in the MS Graph at
+// baseURL, or the mailbox of the signed-in user if userID is empty. The signed-in user is resolved by the object ID in
+// the access token of the request, so that the providers bound to different accounts (e.g. by login_hint) are limited
+// apart, while the ones targeting the same user via "/me" and its object ID are limited together. The mailbox targeted
+// by the object ID and the one by the user principal name can't be told the same without calling MS Graph, hence they
+// are limited apart.
+func mailboxKey(baseURL, userID string, req *http.Request) string {
+	if userID == "" {
+		// The access token of personal Microsoft accounts is opaque, whose account is unknown.
+		userID = "me"
+		if claims, err := msauth.ParseClaims(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")); err == nil && claims.ObjectID != "" {
+			userID = claims.ObjectID
+		}
+	}
+	return strings.ToLower(baseURL + "/users/" + userID)
+}
+
+// getMailboxLimiter returns the mailboxLimiter of the mailbox identified by key (see mailboxKey), which is created with
+// the options if absent. Otherwise, the options of the existing one win, as the limits are per mailbox.
+func getMailboxLimiter(key string, options LimitOptions) *mailboxLimiter {
+	mailboxLimiters.Lock()
+	defer mailboxLimiters.Unlock()
+	if l, ok := mailboxLimiters.m[key]; ok {
+		if l.options != options {
+			log.Printf("[WARN] the request limits %+v of %s are ignored, in favor of the ones already in use: %+v", options, key, l.options)
+		}
+		return l
+	}
+	l := &mailboxLimiter{key: key, options: options}
+	if options.MaxConcurrentRequests > 0 {
+		l.sem = make(chan struct{}, options.MaxConcurrentRequests)
+	}
+	if options.RequestsPerWindow > 0 && options.Window > 0 {
+		l.starts = make([]time.Time, options.RequestsPerWindow)
+	}
+	mailboxLimiters.m[key] = l
+	return l
+}
+
+// acquire blocks until the request is allowed to be sent, the returned func releases the slot of the request.
+func (l *mailboxLimiter) acquire(ctx context.Context) (func(), error) {
+	release := func() {}
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		var once sync.Once
+		release = func() { once.Do(func() { <-l.sem }) }
+	}
+	if err := l.wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// wait blocks until the request is within the budget of the window.
+func (l *mailboxLimiter) wait(ctx context.Context) error {
+	if l.starts == nil {
+		return nil
+	}
+	for {
+		l.mutex.Lock()
+		// The oldest of the last RequestsPerWindow requests is the next one to overwrite.
+		delay := time.Until(l.starts[l.next].Add(l.options.Window))
+		if delay <= 0 {
+			l.starts[l.next] = time.Now()
+			l.next = (l.next + 1) % len(l.starts)
+			l.mutex.Unlock()
+			return nil
+		}
+		l.mutex.Unlock()
+
+		log.Printf("[DEBUG] the request budget (%d per %s) of %s is exhausted, waiting for %s", l.options.RequestsPerWindow, l.options.Window, l.key, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// limitTransport sends the requests within the limits of the mailboxLimiter of the mailbox targeted by userID (see
+// mailboxKey), which is resolved by the first request, as the signed-in user is only known from the access token.
+// The slot of a request is released once its response body is read in full.
+type limitTransport struct {
+	base    http.RoundTripper
+	baseURL string
+	userID  string
+	options LimitOptions
+
+	mutex   sync.Mutex
+	limiter *mailboxLimiter
+}
+
+// mailboxLimiter returns the mailboxLimiter of the mailbox, which is resolved by the authorized request "req".
+func (t *limitTransport) mailboxLimiter(req *http.Request) *mailboxLimiter {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.limiter == nil {
+		t.limiter = getMailboxLimiter(mailboxKey(t.baseURL, t.userID, req), t.options)
+	}
+	return t.limiter
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := t.mailboxLimiter(req).acquire(req.Context())
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	// The callers might send the next request before closing the body of the current one (e.g. the paging of
+	// msgraph.go, which doesn't read the body to the end either), which would wait for the slot forever. Hence the body
+	// is read in full before releasing the slot, the responses of MS Graph are small enough to be buffered.
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	release()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return resp, nil
+}
@@ -0,0 +1,151 @@
+package clients
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// newTestAuthorizedRequest returns a request authorized by an access token of the object ID "oid", or an opaque token if
+// "oid" is empty.
+func newTestAuthorizedRequest(t *testing.T, oid string) *http.Request {
+	req, err := http.NewRequest(http.MethodGet, "https://graph.microsoft.com/v1.0/me", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := "opaque"
+	if oid != "" {
+		b, err := json.Marshal(map[string]string{"oid": oid})
+		if err != nil {
+			t.Fatal(err)
+		}
+		token = "e30." + base64.RawURLEncoding.EncodeToString(b) + ".sig"
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestMailboxKey(t *testing.T) {
+	const baseURL = "https://graph.microsoft.com/v1.0"
+	alice := mailboxKey(baseURL, "", newTestAuthorizedRequest(t, "Alice-OID"))
+	if v := mailboxKey(baseURL, "alice-oid", newTestAuthorizedRequest(t, "app-oid")); v != alice {
+		t.Fatalf("expect the signed-in user and its object ID to be the same mailbox, got %s and %s", alice, v)
+	}
+	if v := mailboxKey(baseURL, "", newTestAuthorizedRequest(t, "bob-oid")); v == alice {
+		t.Fatalf("expect the signed-in users of different accounts to be different mailboxes, got %s", v)
+	}
+	if v := mailboxKey("https://graph.microsoft.us/v1.0", "", newTestAuthorizedRequest(t, "alice-oid")); v == alice {
+		t.Fatalf("expect the mailboxes of different clouds to be different, got %s", v)
+	}
+	if v := mailboxKey(baseURL, "", newTestAuthorizedRequest(t, "")); v != baseURL+"/users/me" {
+		t.Fatalf("expect the signed-in user of the opaque token to be unknown, got %s", v)
+	}
+}
+
+func TestMailboxLimiter_concurrency(t *testing.T) {
+	l := getMailboxLimiter(t.Name(), LimitOptions{MaxConcurrentRequests: 2})
+	if getMailboxLimiter(t.Name(), LimitOptions{MaxConcurrentRequests: 4}) != l {
+		t.Fatal("expect the limiter to be shared by the same mailbox")
+	}
+
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, err := l.acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		releases = append(releases, release)
+	}
+
+	// The request beyond the concurrency blocks until a slot is released.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expect the request to be blocked, got %v", err)
+	}
+	releases[0]()
+	// Releasing twice has no effect.
+	releases[0]()
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expect the request to be blocked, got %v", err)
+	}
+	release()
+	releases[1]()
+}
+
+func TestMailboxLimiter_window(t *testing.T) {
+	const window = 200 * time.Millisecond
+	l := getMailboxLimiter(t.Name(), LimitOptions{RequestsPerWindow: 2, Window: window})
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, err := l.acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= window {
+		t.Fatalf("expect the requests within the budget not to wait, got %s", elapsed)
+	}
+
+	// The request beyond the budget waits until the first request is out of the window.
+	ctx, cancel := context.WithTimeout(context.Background(), window/4)
+	defer cancel()
+	if _, err := l.acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expect the request to wait, got %v", err)
+	}
+	if _, err := l.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < window {
+		t.Fatalf("expect the request beyond the budget to wait for the window, got %s", elapsed)
+	}
+}
+
+func TestLimitTransport_paging(t *testing.T) {
+	// The pages are chunked, whose bodies are not read to the end by the JSON decoder of msgraph.go, which sends the
+	// request of the next page before closing the body of the current one.
+	const pages = 3
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		value := []map[string]string{{"id": "msg" + strconv.Itoa(page)}}
+		body := map[string]interface{}{"value": value}
+		if page+1 < pages {
+			body["@odata.nextLink"] = "http://" + r.Host + r.URL.Path + "?page=" + strconv.Itoa(page+1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+		// The rest of the body follows after the page is decoded.
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("\n"))
+	}))
+	defer srv.Close()
+
+	init := func(context.Context) (oauth2.TokenSource, error) {
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "foo"}), nil
+	}
+	client := NewClient(init, nil, srv.URL, "", UserFeature{}, DefaultRetryOptions, LimitOptions{MaxConcurrentRequests: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ids, err := client.MailFolders.ListMessageIDs(ctx, "inbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{"msg0", "msg1", "msg2"}; !reflect.DeepEqual(ids, expect) {
+		t.Fatalf("expect %v, got %v", expect, ids)
+	}
+}
@@ -0,0 +1,101 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	msgraph "github.com/yaegashi/msgraph.go/v1.0"
+)
+
+// mailFolderService is the MailFolderService backed by MS Graph.
+type mailFolderService struct {
+	client  *Client
+	builder *msgraph.UserMailFoldersCollectionRequestBuilder
+}
+
+func (s *mailFolderService) List(ctx context.Context, parentID, displayName string) ([]msgraph.MailFolder, error) {
+	if parentID == "" {
+		req := s.builder.Request()
+		if displayName != "" {
+			req.Filter(displayNameFilter(displayName))
+		}
+		return req.Get(ctx)
+	}
+	req := s.builder.ID(parentID).ChildFolders().Request()
+	if displayName != "" {
+		req.Filter(displayNameFilter(displayName))
+	}
+	return req.Get(ctx)
+}
+
+func (s *mailFolderService) Get(ctx context.Context, id string) (*msgraph.MailFolder, error) {
+	return s.builder.ID(id).Request().Get(ctx)
+}
+
+func (s *mailFolderService) Create(ctx context.Context, parentID string, folder *msgraph.MailFolder) (*msgraph.MailFolder, error) {
+	if parentID == "" {
+		return s.builder.Request().Add(ctx, folder)
+	}
+	return s.builder.ID(parentID).ChildFolders().Request().Add(ctx, folder)
+}
+
+func (s *mailFolderService) Update(ctx context.Context, id string, folder *msgraph.MailFolder) error {
+	// Updating the properties to fixed values is idempotent, hence safe to retry.
+	return s.builder.ID(id).Request().Update(WithRetrySafe(ctx), folder)
+}
+
+func (s *mailFolderService) Delete(ctx context.Context, id string) error {
+	return s.builder.ID(id).Request().Delete(ctx)
+}
+
+// maxMessageIDsPageSize is the page size of listing only the IDs of the messages, which is the maximum allowed by MS Graph
+// (the default is only 10).
+const maxMessageIDsPageSize = 1000
+
+func (s *mailFolderService) ListMessageIDs(ctx context.Context, id string) ([]string, error) {
+	req := s.builder.ID(id).Messages().Request()
+	req.Select("id")
+	req.Top(maxMessageIDsPageSize)
+	messages, err := req.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		if msg.ID != nil {
+			ids = append(ids, *msg.ID)
+		}
+	}
+	return ids, nil
+}
+
+// MoveMessages moves the messages via JSON batching.
+func (s *mailFolderService) MoveMessages(ctx context.Context, id string, messageIDs []string, destinationID string) ([]error, error) {
+	requests := make([]BatchRequest, 0, len(messageIDs))
+	for i, messageID := range messageIDs {
+		requests = append(requests, BatchRequest{
+			ID:      strconv.Itoa(i),
+			Method:  http.MethodPost,
+			URL:     s.client.BatchURL(s.builder.ID(id).Messages().ID(messageID).Move(nil).URL()),
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body:    &msgraph.MessageMoveRequestParameter{DestinationID: &destinationID},
+		})
+	}
+	responses, err := s.client.Batch(ctx, requests)
+	if err != nil {
+		return nil, err
+	}
+	errs := make([]error, len(responses))
+	for i, resp := range responses {
+		errs[i] = resp.Err()
+	}
+	return errs, nil
+}
+
+// displayNameFilter returns the OData filter matching the display name, where the single quotes are escaped.
+func displayNameFilter(displayName string) string {
+	return fmt.Sprintf(`displayName eq '%s'`, strings.ReplaceAll(displayName, `'`, `''`))
+}
@@ -0,0 +1,36 @@
+package clients
+
+import (
+	"context"
+
+	msgraph "github.com/yaegashi/msgraph.go/v1.0"
+)
+
+// messageRuleService is the MessageRuleService backed by MS Graph.
+type messageRuleService struct {
+	builder *msgraph.MailFolderMessageRulesCollectionRequestBuilder
+}
+
+func (s *messageRuleService) List(ctx context.Context, displayName string) ([]msgraph.MessageRule, error) {
+	req := s.builder.Request()
+	if displayName != "" {
+		req.Filter(displayNameFilter(displayName))
+	}
+	return req.Get(ctx)
+}
+
+func (s *messageRuleService) Get(ctx context.Context, id string) (*msgraph.MessageRule, error) {
+	return s.builder.ID(id).Request().Get(ctx)
+}
+
+func (s *messageRuleService) Create(ctx context.Context, rule *msgraph.MessageRule) (*msgraph.MessageRule, error) {
+	return s.builder.Request().Add(ctx, rule)
+}
+
+func (s *messageRuleService) Update(ctx context.Context, id string, rule *msgraph.MessageRule) error {
+	return s.builder.ID(id).Request().Update(WithRetrySafe(ctx), rule)
+}
+
+func (s *messageRuleService) Delete(ctx context.Context, id string) error {
+	return s.builder.ID(id).Request().Delete(ctx)
+}
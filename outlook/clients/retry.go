@@ -0,0 +1,220 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryOptions configures the retries of the MS Graph requests, which are throttled or failed transiently.
+type RetryOptions struct {
+	// MaxRetries is the maximum number of retries of a request, 0 disables the retries.
+	MaxRetries int
+	// MinBackoff and MaxBackoff bound the exponential backoff between the retries, unless the response tells how long to
+	// wait via the Retry-After header.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryOptions are the RetryOptions used by the provider, unless configured otherwise.
+var DefaultRetryOptions = RetryOptions{
+	MaxRetries: 8,
+	MinBackoff: time.Second,
+	MaxBackoff: time.Minute,
+}
+
+type retrySafeKey struct{}
+
+// WithRetrySafe returns a copy of ctx, which marks the requests sent with it as safe to retry regardless of the method,
+// e.g. a PATCH request setting the properties to fixed values.
+func WithRetrySafe(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retrySafeKey{}, true)
+}
+
+// isRetrySafe tells whether the request can be retried, which is the case for the idempotent methods, or the requests
+// marked by WithRetrySafe.
+func isRetrySafe(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	safe, _ := req.Context().Value(retrySafeKey{}).(bool)
+	return safe
+}
+
+type retryThrottledKey struct{}
+
+// withRetryThrottled returns a copy of ctx, which marks the requests sent with it as safe to retry only if throttled
+// (i.e. 429), e.g. a JSON batch, which is rejected as a whole before any individual request is executed, while it may be
+// executed partially on other failures.
+func withRetryThrottled(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryThrottledKey{}, true)
+}
+
+// retryTransport retries the requests throttled (i.e. 429, or the MailboxConcurrency error of Outlook) or failed
+// transiently (i.e. 503, 504 and the network errors, rather than the token errors), with jittered exponential backoff.
+// The Retry-After header of the response is honored. It gives up once the retry can't be done before the deadline of
+// the request context (e.g. the timeout of the resource).
+// (See https://docs.microsoft.com/en-us/graph/throttling)
+type retryTransport struct {
+	base    http.RoundTripper
+	options RetryOptions
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	throttledOnly := false
+	if !isRetrySafe(req) {
+		throttledOnly, _ = req.Context().Value(retryThrottledKey{}).(bool)
+		if !throttledOnly {
+			return t.base.RoundTrip(req)
+		}
+	}
+	if t.options.MaxRetries <= 0 || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return t.base.RoundTrip(req)
+	}
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		resp, err := t.base.RoundTrip(req)
+		reason, retry := retryReason(req.Context(), resp, err)
+		if throttledOnly && (resp == nil || resp.StatusCode != http.StatusTooManyRequests) {
+			retry = false
+		}
+		if !retry || attempt >= t.options.MaxRetries {
+			return resp, err
+		}
+
+		var retryAfter string
+		if resp != nil {
+			retryAfter = resp.Header.Get("Retry-After")
+		}
+		wait := t.options.backoff(attempt, retryAfter)
+		if deadline, ok := req.Context().Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			log.Printf("[DEBUG] not retrying %s %s (%s), as the wait (%s) exceeds the deadline", req.Method, req.URL, reason, wait)
+			return resp, err
+		}
+		log.Printf("[INFO] retrying %s %s in %s (%d/%d): %s", req.Method, req.URL, wait, attempt+1, t.options.MaxRetries, reason)
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryReason tells whether the response (or the error) is retryable, and why.
+func retryReason(ctx context.Context, resp *http.Response, err error) (string, bool) {
+	if err != nil {
+		// The context errors and the token errors (e.g. an invalid client secret) are not transient.
+		var terr *tokenError
+		if ctx.Err() != nil || errors.As(err, &terr) {
+			return "", false
+		}
+		return err.Error(), true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return resp.Status, true
+	}
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && isMailboxConcurrencyError(resp) {
+		return fmt.Sprintf("%s (MailboxConcurrency)", resp.Status), true
+	}
+	return "", false
+}
+
+// isMailboxConcurrencyError tells whether the MS Graph error response is caused by exceeding the concurrent requests
+// limit of the mailbox. The response body is kept intact for the caller.
+func isMailboxConcurrencyError(resp *http.Response) bool {
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return false
+	}
+	return isMailboxConcurrencyErrorBody(b)
+}
+
+// isMailboxConcurrencyErrorBody tells whether the MS Graph error body reports the MailboxConcurrency error, in either the
+// code or the message of the error (or its inner errors), e.g.:
+//
+//	{"error": {"code": "ApplicationThrottled", "message": "Application is over its MailboxConcurrency limit."}}
+func isMailboxConcurrencyErrorBody(b []byte) bool {
+	type graphError struct {
+		Code       string      `json:"code"`
+		Message    string      `json:"message"`
+		InnerError *graphError `json:"innerError"`
+	}
+	var body struct {
+		Error *graphError `json:"error"`
+	}
+	if err := json.Unmarshal(b, &body); err != nil {
+		return false
+	}
+	for e := body.Error; e != nil; e = e.InnerError {
+		if e.Code == "MailboxConcurrency" || strings.Contains(e.Message, "MailboxConcurrency") {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns how long to wait before the next retry, which is the Retry-After header of the response if any,
+// otherwise the exponential backoff with jitter.
+func (o RetryOptions) backoff(attempt int, retryAfter string) time.Duration {
+	if wait, ok := parseRetryAfter(retryAfter); ok {
+		return wait
+	}
+	wait := o.MaxBackoff
+	if attempt < 32 {
+		if exp := o.MinBackoff << uint(attempt); exp > 0 && exp < wait {
+			wait = exp
+		}
+	}
+	// Half of the backoff is jittered, so that the concurrent requests don't retry all at once.
+	half := wait / 2
+	if half <= 0 {
+		return wait
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// parseRetryAfter parses the Retry-After header, which is either the seconds to wait, or an HTTP date.
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if wait := time.Until(t); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,298 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripperFunc plays as the RoundTripper under retryTransport.
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newTestResponse(code int, header http.Header, body string) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		StatusCode: code,
+		Status:     http.StatusText(code),
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	cases := []struct {
+		in   string
+		wait time.Duration
+		ok   bool
+	}{
+		{in: ""},
+		{in: "foo"},
+		{in: "-1"},
+		{in: "0", ok: true},
+		{in: "120", wait: 2 * time.Minute, ok: true},
+		{in: "Mon, 02 Jan 2006 15:04:05 GMT", ok: true},
+	}
+	for _, c := range cases {
+		wait, ok := parseRetryAfter(c.in)
+		if wait != c.wait || ok != c.ok {
+			t.Errorf("%q: expect (%s, %t), got (%s, %t)", c.in, c.wait, c.ok, wait, ok)
+		}
+	}
+
+	// The HTTP date in the future.
+	wait, ok := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if !ok || wait <= 50*time.Second || wait > time.Minute {
+		t.Errorf("expect about 1m to wait, got (%s, %t)", wait, ok)
+	}
+}
+
+func TestRetryOptions_backoff(t *testing.T) {
+	o := RetryOptions{MinBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	cases := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{attempt: 0, min: 500 * time.Millisecond, max: time.Second},
+		{attempt: 2, min: 2 * time.Second, max: 4 * time.Second},
+		{attempt: 4, min: 5 * time.Second, max: 10 * time.Second},
+		// No overflow of the shift.
+		{attempt: 40, min: 5 * time.Second, max: 10 * time.Second},
+		{attempt: 1000, min: 5 * time.Second, max: 10 * time.Second},
+	}
+	for _, c := range cases {
+		for i := 0; i < 100; i++ {
+			if wait := o.backoff(c.attempt, ""); wait < c.min || wait > c.max {
+				t.Fatalf("attempt %d: expect the backoff within [%s, %s], got %s", c.attempt, c.min, c.max, wait)
+			}
+		}
+	}
+
+	// The Retry-After header is honored, even beyond the maximum backoff.
+	if wait := o.backoff(0, "30"); wait != 30*time.Second {
+		t.Fatalf("expect Retry-After to be honored, got %s", wait)
+	}
+}
+
+func TestIsMailboxConcurrencyError(t *testing.T) {
+	cases := map[string]bool{
+		`{"error": {"code": "MailboxConcurrency", "message": "foo"}}`:                                                 true,
+		`{"error": {"code": "ApplicationThrottled", "message": "Application is over its MailboxConcurrency limit."}}`: true,
+		`{"error": {"code": "ErrorAccessDenied", "innerError": {"code": "MailboxConcurrency"}}}`:                      true,
+		`{"error": {"code": "ErrorAccessDenied", "message": "Access is denied."}}`:                                    false,
+		`not json`: false,
+	}
+	for body, expect := range cases {
+		resp := newTestResponse(http.StatusForbidden, nil, body)
+		if v := isMailboxConcurrencyError(resp); v != expect {
+			t.Errorf("%s: expect %t, got %t", body, expect, v)
+		}
+		// The body is kept intact for the caller.
+		if b, _ := ioutil.ReadAll(resp.Body); string(b) != body {
+			t.Errorf("expect the body kept intact, got %s", b)
+		}
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	throttled := func() (*http.Response, error) {
+		return newTestResponse(http.StatusTooManyRequests, http.Header{"Retry-After": {"0"}}, ""), nil
+	}
+	cases := []struct {
+		name      string
+		method    string
+		body      string
+		ctx       func() (context.Context, context.CancelFunc)
+		responses []func() (*http.Response, error)
+		code      int
+		err       string
+		attempts  int
+	}{
+		{
+			name:      "throttled",
+			method:    http.MethodGet,
+			responses: []func() (*http.Response, error){throttled, throttled},
+			code:      http.StatusOK,
+			attempts:  3,
+		},
+		{
+			name:   "mailbox concurrency",
+			method: http.MethodGet,
+			responses: []func() (*http.Response, error){
+				func() (*http.Response, error) {
+					return newTestResponse(http.StatusForbidden, nil, `{"error": {"code": "MailboxConcurrency"}}`), nil
+				},
+			},
+			code:     http.StatusOK,
+			attempts: 2,
+		},
+		{
+			name:   "network error",
+			method: http.MethodGet,
+			responses: []func() (*http.Response, error){
+				func() (*http.Response, error) { return nil, errors.New("connection reset by peer") },
+			},
+			code:     http.StatusOK,
+			attempts: 2,
+		},
+		{
+			name:   "token error",
+			method: http.MethodGet,
+			responses: []func() (*http.Response, error){
+				func() (*http.Response, error) { return nil, &tokenError{errors.New("invalid_client")} },
+			},
+			err:      "invalid_client",
+			attempts: 1,
+		},
+		{
+			name:   "not found",
+			method: http.MethodGet,
+			responses: []func() (*http.Response, error){
+				func() (*http.Response, error) { return newTestResponse(http.StatusNotFound, nil, ""), nil },
+			},
+			code:     http.StatusNotFound,
+			attempts: 1,
+		},
+		{
+			name:      "max retries",
+			method:    http.MethodGet,
+			responses: []func() (*http.Response, error){throttled, throttled, throttled, throttled},
+			code:      http.StatusTooManyRequests,
+			attempts:  4,
+		},
+		{
+			name:      "unsafe",
+			method:    http.MethodPost,
+			body:      "foo",
+			responses: []func() (*http.Response, error){throttled},
+			code:      http.StatusTooManyRequests,
+			attempts:  1,
+		},
+		{
+			name:   "retry safe",
+			method: http.MethodPost,
+			body:   "foo",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return WithRetrySafe(context.Background()), func() {}
+			},
+			responses: []func() (*http.Response, error){throttled},
+			code:      http.StatusOK,
+			attempts:  2,
+		},
+		{
+			name:   "retry throttled",
+			method: http.MethodPost,
+			body:   "foo",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return withRetryThrottled(context.Background()), func() {}
+			},
+			responses: []func() (*http.Response, error){throttled},
+			code:      http.StatusOK,
+			attempts:  2,
+		},
+		{
+			name:   "retry throttled only",
+			method: http.MethodPost,
+			body:   "foo",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return withRetryThrottled(context.Background()), func() {}
+			},
+			responses: []func() (*http.Response, error){
+				func() (*http.Response, error) { return newTestResponse(http.StatusServiceUnavailable, nil, ""), nil },
+			},
+			code:     http.StatusServiceUnavailable,
+			attempts: 1,
+		},
+		{
+			name:   "deadline",
+			method: http.MethodGet,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Second)
+			},
+			responses: []func() (*http.Response, error){
+				func() (*http.Response, error) {
+					return newTestResponse(http.StatusTooManyRequests, http.Header{"Retry-After": {"60"}}, ""), nil
+				},
+			},
+			code:     http.StatusTooManyRequests,
+			attempts: 1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var attempts int
+			transport := &retryTransport{
+				base: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					attempts++
+					if c.body != "" {
+						// The body is replayed by every attempt.
+						b, _ := ioutil.ReadAll(req.Body)
+						if string(b) != c.body {
+							t.Errorf("attempt %d: expect the body %q, got %q", attempts, c.body, b)
+						}
+					}
+					if attempts <= len(c.responses) {
+						return c.responses[attempts-1]()
+					}
+					return newTestResponse(http.StatusOK, nil, ""), nil
+				}),
+				options: RetryOptions{MaxRetries: 3, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond},
+			}
+
+			ctx, cancel := context.Background(), func() {}
+			if c.ctx != nil {
+				ctx, cancel = c.ctx()
+			}
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, c.method, "https://graph.microsoft.com/v1.0/me", bytes.NewReader([]byte(c.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.body == "" {
+				req.Body, req.GetBody = http.NoBody, nil
+			}
+
+			resp, err := transport.RoundTrip(req)
+			if c.err != "" {
+				if err == nil || err.Error() != c.err {
+					t.Fatalf("expect the error %q, got %v", c.err, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if resp.StatusCode != c.code {
+				t.Fatalf("expect the status code %d, got %d", c.code, resp.StatusCode)
+			}
+			if attempts != c.attempts {
+				t.Fatalf("expect %d attempts, got %d", c.attempts, attempts)
+			}
+		})
+	}
+}
+
+func TestRetryTransport_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	transport := &retryTransport{
+		base: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			cancel()
+			return newTestResponse(http.StatusServiceUnavailable, nil, ""), nil
+		}),
+		options: RetryOptions{MaxRetries: 3, MinBackoff: time.Minute, MaxBackoff: time.Minute},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://graph.microsoft.com/v1.0/me", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := transport.RoundTrip(req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect canceled, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package clients
+
+import (
+	"context"
+
+	msgraph "github.com/yaegashi/msgraph.go/v1.0"
+)
+
+// MailFolderService manages the mail folders of the mailbox.
+type MailFolderService interface {
+	// List lists the child folders of the parent folder, or the top level folders if parentID is empty. If displayName
+	// is not empty, only the folders with the display name are listed.
+	List(ctx context.Context, parentID, displayName string) ([]msgraph.MailFolder, error)
+	// Get gets the folder by its ID or well-known name (e.g. "inbox").
+	Get(ctx context.Context, id string) (*msgraph.MailFolder, error)
+	// Create creates the folder under the parent folder, or at the top level if parentID is empty.
+	Create(ctx context.Context, parentID string, folder *msgraph.MailFolder) (*msgraph.MailFolder, error)
+	Update(ctx context.Context, id string, folder *msgraph.MailFolder) error
+	Delete(ctx context.Context, id string) error
+	// ListMessageIDs lists the IDs of the messages in the folder.
+	ListMessageIDs(ctx context.Context, id string) ([]string, error)
+	// MoveMessages moves the messages in the folder to the destination folder. The returned errors are the ones of the
+	// individual messages (nil for the moved ones), in the order of messageIDs.
+	MoveMessages(ctx context.Context, id string, messageIDs []string, destinationID string) ([]error, error)
+}
+
+// MessageRuleService manages the message rules of the inbox.
+type MessageRuleService interface {
+	// List lists the message rules. If displayName is not empty, only the rules with the display name are listed.
+	List(ctx context.Context, displayName string) ([]msgraph.MessageRule, error)
+	Get(ctx context.Context, id string) (*msgraph.MessageRule, error)
+	Create(ctx context.Context, rule *msgraph.MessageRule) (*msgraph.MessageRule, error)
+	Update(ctx context.Context, id string, rule *msgraph.MessageRule) error
+	Delete(ctx context.Context, id string) error
+}
+
+// CategoryService manages the master categories of the user.
+type CategoryService interface {
+	// List lists all the categories, which can't be filtered by MS Graph.
+	List(ctx context.Context) ([]msgraph.OutlookCategory, error)
+	Get(ctx context.Context, id string) (*msgraph.OutlookCategory, error)
+	Create(ctx context.Context, category *msgraph.OutlookCategory) (*msgraph.OutlookCategory, error)
+	Update(ctx context.Context, id string, category *msgraph.OutlookCategory) error
+	Delete(ctx context.Context, id string) error
+}
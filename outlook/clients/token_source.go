@@ -0,0 +1,135 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/magodo/terraform-provider-outlook/msauth"
+	"golang.org/x/oauth2"
+)
+
+// TokenSourceFunc initializes the token source, e.g. by login, which is aborted once ctx is done.
+type TokenSourceFunc func(ctx context.Context) (oauth2.TokenSource, error)
+
+// lazyTokenSource initializes the underlying token source by the first token request, i.e. on the first outgoing
+// request to MS Graph. The initialization is done only once, whose error is returned for all the token requests,
+// unless it is aborted by the context of the request (e.g. Terraform stops the provider during the login).
+type lazyTokenSource struct {
+	init TokenSourceFunc
+
+	mutex sync.Mutex
+	ts    oauth2.TokenSource
+	err   error
+}
+
+// tokenError is the error of obtaining the token, e.g. an invalid client secret or a revoked refresh token, which is not
+// retried by retryTransport.
+type tokenError struct {
+	err error
+}
+
+func (e *tokenError) Error() string {
+	return e.err.Error()
+}
+
+func (e *tokenError) Unwrap() error {
+	return e.err
+}
+
+func (s *lazyTokenSource) source(ctx context.Context) (oauth2.TokenSource, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ts == nil && s.err == nil {
+		ts, err := s.init(ctx)
+		if err != nil && ctx.Err() != nil {
+			return nil, err
+		}
+		s.ts, s.err = ts, err
+	}
+	return s.ts, s.err
+}
+
+// Token returns the token of the underlying token source, whose errors are wrapped as tokenError.
+func (s *lazyTokenSource) Token() (*oauth2.Token, error) {
+	return s.TokenWithContext(context.Background())
+}
+
+// TokenWithContext is similar to Token, except the underlying token source obtains the token under ctx, if supported.
+func (s *lazyTokenSource) TokenWithContext(ctx context.Context) (*oauth2.Token, error) {
+	ts, err := s.source(ctx)
+	if err != nil {
+		return nil, &tokenError{err}
+	}
+	t, err := msauth.TokenWithContext(ctx, ts)
+	if err != nil {
+		return nil, &tokenError{err}
+	}
+	return t, nil
+}
+
+func (s *lazyTokenSource) TokenWithClaims(claims string) (*oauth2.Token, error) {
+	ts, err := s.source(context.Background())
+	if err != nil {
+		return nil, &tokenError{err}
+	}
+	cts, ok := ts.(msauth.ClaimsTokenSource)
+	if !ok {
+		return nil, errors.New("the token source doesn't support claims challenge")
+	}
+	t, err := cts.TokenWithClaims(claims)
+	if err != nil {
+		return nil, &tokenError{err}
+	}
+	return t, nil
+}
+
+// initialized tells whether the underlying token source is initialized successfully.
+func (s *lazyTokenSource) initialized() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ts != nil
+}
+
+// readWriteTokenSource authorizes the read requests (i.e. GET and HEAD) by the "read" token source (if any), until the
+// first write request initializes the "write" one, which authorizes all the requests afterwards. So that the plans only
+// reading the resources never need the read-write permissions.
+type readWriteTokenSource struct {
+	read  *lazyTokenSource
+	write *lazyTokenSource
+}
+
+// source returns the token source of the request with the method.
+func (s *readWriteTokenSource) source(method string) *lazyTokenSource {
+	if s.read == nil || s.write.initialized() {
+		return s.write
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return s.read
+	}
+	return s.write
+}
+
+// Token returns the token which authorizes the read requests.
+func (s *readWriteTokenSource) Token() (*oauth2.Token, error) {
+	return s.source(http.MethodGet).Token()
+}
+
+// initTransport initializes the token source of the request with the context of the request, before the request is
+// authorized by it.
+type initTransport struct {
+	base   http.RoundTripper
+	source *readWriteTokenSource
+}
+
+func (t *initTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	source := t.source.source(req.Method)
+	if _, err := source.source(req.Context()); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, &tokenError{err}
+	}
+	return (&msauth.Transport{Source: source, Base: t.base}).RoundTrip(req)
+}
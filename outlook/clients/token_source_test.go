@@ -0,0 +1,124 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestLazyTokenSource(t *testing.T) {
+	var calls int
+	s := &lazyTokenSource{init: func(context.Context) (oauth2.TokenSource, error) {
+		calls++
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "foo"}), nil
+	}}
+	if calls != 0 {
+		t.Fatalf("expect no initialization before any token request, got %d", calls)
+	}
+
+	// The token source is initialized only once.
+	for i := 0; i < 2; i++ {
+		token, err := s.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.AccessToken != "foo" {
+			t.Fatalf("expect access token foo, got %s", token.AccessToken)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expect 1 initialization, got %d", calls)
+	}
+}
+
+func TestLazyTokenSource_error(t *testing.T) {
+	var calls int
+	s := &lazyTokenSource{init: func(ctx context.Context) (oauth2.TokenSource, error) {
+		calls++
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("invalid_client")
+	}}
+
+	// The initialization aborted by the context is done again by the next request.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.source(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect canceled, got %v", err)
+	}
+
+	// Other errors are returned for all the later requests, without initializing again, which are not retried.
+	for i := 0; i < 2; i++ {
+		var terr *tokenError
+		if _, err := s.Token(); !errors.As(err, &terr) || err.Error() != "invalid_client" {
+			t.Fatalf("expect the initialization error, got %v", err)
+		}
+	}
+	if _, err := s.TokenWithClaims(`{"access_token":{}}`); err == nil || err.Error() != "invalid_client" {
+		t.Fatalf("expect the initialization error, got %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expect 2 initializations, got %d", calls)
+	}
+}
+
+func TestLazyTokenSource_claims(t *testing.T) {
+	// The claims challenge is not supported by e.g. a static access token.
+	s := &lazyTokenSource{init: func(context.Context) (oauth2.TokenSource, error) {
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "foo"}), nil
+	}}
+	if _, err := s.TokenWithClaims(`{"access_token":{}}`); err == nil {
+		t.Fatal("expect error, got nil")
+	}
+}
+
+func TestInitTransport_readWrite(t *testing.T) {
+	calls := map[string]int{}
+	newSource := func(token string) *lazyTokenSource {
+		return &lazyTokenSource{init: func(context.Context) (oauth2.TokenSource, error) {
+			calls[token]++
+			return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}), nil
+		}}
+	}
+	tr := &initTransport{
+		base: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Authorization": req.Header["Authorization"]}, Body: http.NoBody}, nil
+		}),
+		source: &readWriteTokenSource{read: newSource("read"), write: newSource("write")},
+	}
+	do := func(method string) string {
+		req, err := http.NewRequest(method, "https://graph.microsoft.com/v1.0/me/mailFolders", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Header.Get("Authorization")
+	}
+
+	// The read requests don't initialize the write token source, e.g. during the plan.
+	for i := 0; i < 2; i++ {
+		if auth := do(http.MethodGet); auth != "Bearer read" {
+			t.Fatalf("expect the read token, got %q", auth)
+		}
+	}
+	if calls["write"] != 0 {
+		t.Fatal("expect the write token source not initialized by the read requests")
+	}
+
+	// The first write request initializes the write token source, which is used by all the requests afterwards.
+	for _, method := range []string{http.MethodPost, http.MethodGet} {
+		if auth := do(method); auth != "Bearer write" {
+			t.Fatalf("expect the write token for %s, got %q", method, auth)
+		}
+	}
+	if calls["read"] != 1 || calls["write"] != 1 {
+		t.Fatalf("expect each token source initialized once, got %v", calls)
+	}
+}
@@ -0,0 +1,629 @@
+// Package graphtest provides a fake MS Graph server serving the Outlook APIs used by the provider, for running the
+// acceptance tests offline.
+package graphtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/magodo/terraform-provider-outlook/msauth/authtest"
+	"github.com/magodo/terraform-provider-outlook/outlook/clients"
+	"github.com/magodo/terraform-provider-outlook/outlook/clients/clientstest"
+	msgraph "github.com/yaegashi/msgraph.go/v1.0"
+)
+
+// DefaultScopes are the delegated permissions granted to the AccessToken, unless Server.Scopes is set.
+var DefaultScopes = []string{"Mail.ReadWrite", "MailboxSettings.ReadWrite", "User.Read"}
+
+// Server is a fake MS Graph, which serves the mailbox of the User at "<URL>/v1.0/me" and "<URL>/v1.0/users/<id or upn>":
+//
+//	/mailFolders[/<id>[/childFolders]]
+//	/mailFolders/<id>/messages[/<id>/move]
+//	/mailFolders/inbox/messageRules[/<id>]
+//	/outlook/masterCategories[/<id>]
+//
+// It also serves the JSON batching at "<URL>/v1.0/$batch". The collections are paged by PageSize, and can be filtered
+// by "displayName eq '<name>'" (except the categories, same as MS Graph). The errors are responded in the same form as
+// MS Graph.
+//
+// The mailbox is stored in Fakes, which can be used to seed or inspect the mailbox. The requests are authorized by the
+// AccessToken, which is an unsigned JWT of the User granted with the Scopes.
+//
+// The fields are meant to be set before the Server is used.
+type Server struct {
+	*httptest.Server
+
+	User   authtest.User
+	Scopes []string
+	Fakes  *clientstest.Fakes
+	// PageSize is the default page size of the collections, which is 10 like MS Graph.
+	PageSize int
+	// Intercept, if not nil, is called before serving every request (including the individual requests of the JSON
+	// batches), which tells whether it has responded to the request, e.g. to inject the throttling.
+	Intercept func(w http.ResponseWriter, r *http.Request) bool
+}
+
+// NewServer starts a Server of an empty mailbox of authtest.DefaultUser, the caller should call Close when finished.
+func NewServer() *Server {
+	s := &Server{
+		User:     authtest.DefaultUser,
+		Scopes:   DefaultScopes,
+		Fakes:    clientstest.NewFakes(),
+		PageSize: 10,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// AccessToken returns the access token accepted by the Server, e.g. for the "access_token" of the provider.
+func (s *Server) AccessToken() string {
+	enc := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"typ": "JWT", "alg": "none"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"aud":  "https://graph.microsoft.com",
+		"iss":  fmt.Sprintf("https://sts.windows.net/%s/", s.User.TenantID),
+		"oid":  s.User.ObjectID,
+		"tid":  s.User.TenantID,
+		"upn":  s.User.Username,
+		"name": s.User.Name,
+		"scp":  strings.Join(s.Scopes, " "),
+	})
+	return enc.EncodeToString(header) + "." + enc.EncodeToString(claims) + "."
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if s.Intercept != nil && s.Intercept(w, r) {
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+s.AccessToken() {
+		writeError(w, http.StatusUnauthorized, "InvalidAuthenticationToken", "Access token validation failure. Invalid audience.")
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/v1.0/") {
+		writeError(w, http.StatusBadRequest, "BadRequest", "Invalid version.")
+		return
+	}
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1.0/"), "/"), "/")
+	switch {
+	case len(segments) == 1 && segments[0] == "$batch":
+		s.serveBatch(w, r)
+		return
+	case segments[0] == "me":
+		segments = segments[1:]
+	case segments[0] == "users" && len(segments) > 1:
+		if segments[1] != s.User.ObjectID && !strings.EqualFold(segments[1], s.User.Username) {
+			writeError(w, http.StatusNotFound, "Request_ResourceNotFound", fmt.Sprintf("Resource '%s' does not exist or one of its queried reference-property objects are not present.", segments[1]))
+			return
+		}
+		segments = segments[2:]
+	default:
+		writeBadSegment(w, segments[0])
+		return
+	}
+
+	switch {
+	case len(segments) == 0:
+		s.serveUser(w, r)
+	case segments[0] == "mailFolders":
+		if len(segments) >= 3 && segments[2] == "messageRules" {
+			s.serveMessageRules(w, r, segments[1], segments[3:])
+			return
+		}
+		s.serveMailFolders(w, r, segments[1:])
+	case segments[0] == "outlook" && len(segments) >= 2 && segments[1] == "masterCategories":
+		s.serveCategories(w, r, segments[2:])
+	default:
+		writeBadSegment(w, segments[0])
+	}
+}
+
+func (s *Server) serveUser(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) || !s.authorize(w, r, "User") {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"@odata.context":    s.URL + "/v1.0/$metadata#users/$entity",
+		"id":                s.User.ObjectID,
+		"displayName":       s.User.Name,
+		"mail":              s.User.Username,
+		"userPrincipalName": s.User.Username,
+	})
+}
+
+func (s *Server) serveMailFolders(w http.ResponseWriter, r *http.Request, segments []string) {
+	ctx := r.Context()
+	folders := s.Fakes.MailFolders
+	if !s.authorize(w, r, "Mail") {
+		return
+	}
+	switch {
+	case len(segments) == 0 || (len(segments) == 2 && segments[1] == "childFolders"):
+		var parentID string
+		if len(segments) != 0 {
+			parentID = segments[0]
+		}
+		switch r.Method {
+		case http.MethodGet:
+			displayName, ok := parseDisplayNameFilter(w, r)
+			if !ok {
+				return
+			}
+			objs, err := folders.List(ctx, parentID, displayName)
+			if err != nil {
+				writeGraphError(w, err)
+				return
+			}
+			s.writeCollection(w, r, objs)
+		case http.MethodPost:
+			var folder msgraph.MailFolder
+			if !decodeJSON(w, r, &folder) {
+				return
+			}
+			obj, err := folders.Create(ctx, parentID, &folder)
+			if err != nil {
+				writeGraphError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusCreated, obj)
+		default:
+			writeMethodNotAllowed(w)
+		}
+	case len(segments) == 1:
+		id := segments[0]
+		switch r.Method {
+		case http.MethodGet:
+			obj, err := folders.Get(ctx, id)
+			if err != nil {
+				writeGraphError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, obj)
+		case http.MethodPatch:
+			var folder msgraph.MailFolder
+			if !decodeJSON(w, r, &folder) {
+				return
+			}
+			if err := folders.Update(ctx, id, &folder); err != nil {
+				writeGraphError(w, err)
+				return
+			}
+			obj, err := folders.Get(ctx, id)
+			if err != nil {
+				writeGraphError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, obj)
+		case http.MethodDelete:
+			if err := folders.Delete(ctx, id); err != nil {
+				writeGraphError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeMethodNotAllowed(w)
+		}
+	case len(segments) == 2 && segments[1] == "messages":
+		if !allowMethods(w, r, http.MethodGet) {
+			return
+		}
+		ids, err := folders.ListMessageIDs(ctx, segments[0])
+		if err != nil {
+			writeGraphError(w, err)
+			return
+		}
+		messages := make([]map[string]string, 0, len(ids))
+		for _, id := range ids {
+			messages = append(messages, map[string]string{
+				"@odata.etag": `W/"CQAAABYAAAD` + id[len(id)-12:] + `"`,
+				"id":          id,
+			})
+		}
+		s.writeCollection(w, r, messages)
+	case len(segments) == 4 && segments[1] == "messages" && segments[3] == "move":
+		if !allowMethods(w, r, http.MethodPost) {
+			return
+		}
+		var param msgraph.MessageMoveRequestParameter
+		if !decodeJSON(w, r, &param) {
+			return
+		}
+		if param.DestinationID == nil {
+			writeError(w, http.StatusBadRequest, "ErrorInvalidParameter", "The destinationId parameter is missing.")
+			return
+		}
+		id, err := folders.MoveMessage(ctx, segments[0], segments[2], *param.DestinationID)
+		if err != nil {
+			writeGraphError(w, err)
+			return
+		}
+		destination, err := folders.Get(ctx, *param.DestinationID)
+		if err != nil {
+			writeGraphError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"id": id, "parentFolderId": *destination.ID})
+	default:
+		writeBadSegment(w, segments[len(segments)-1])
+	}
+}
+
+func (s *Server) serveMessageRules(w http.ResponseWriter, r *http.Request, folderID string, segments []string) {
+	ctx := r.Context()
+	rules := s.Fakes.MessageRules
+	if !s.authorize(w, r, "MailboxSettings") {
+		return
+	}
+	// The message rules are only supported by the inbox.
+	inbox, err := s.Fakes.MailFolders.Get(ctx, "inbox")
+	if err != nil {
+		writeGraphError(w, err)
+		return
+	}
+	if folder, err := s.Fakes.MailFolders.Get(ctx, folderID); err != nil || *folder.ID != *inbox.ID {
+		writeError(w, http.StatusBadRequest, "ErrorInvalidRequest", "The message rules are only supported by the Inbox folder.")
+		return
+	}
+
+	switch {
+	case len(segments) == 0:
+		switch r.Method {
+		case http.MethodGet:
+			displayName, ok := parseDisplayNameFilter(w, r)
+			if !ok {
+				return
+			}
+			objs, err := rules.List(ctx, displayName)
+			if err != nil {
+				writeGraphError(w, err)
+				return
+			}
+			s.writeCollection(w, r, objs)
+		case http.MethodPost:
+			var rule msgraph.MessageRule
+			if !decodeJSON(w, r, &rule) {
+				return
+			}
+			obj, err := rules.Create(ctx, &rule)
+			if err != nil {
+				writeGraphError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusCreated, obj)
+		default:
+			writeMethodNotAllowed(w)
+		}
+	case len(segments) == 1:
+		id := segments[0]
+		switch r.Method {
+		case http.MethodGet:
+			obj, err := rules.Get(ctx, id)
+			if err != nil {
+				writeGraphError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, obj)
+		case http.MethodPatch:
+			var rule msgraph.MessageRule
+			if !decodeJSON(w, r, &rule) {
+				return
+			}
+			if err := rules.Update(ctx, id, &rule); err != nil {
+				writeGraphError(w, err)
+				return
+			}
+			obj, err := rules.Get(ctx, id)
+			if err != nil {
+				writeGraphError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, obj)
+		case http.MethodDelete:
+			if err := rules.Delete(ctx, id); err != nil {
+				writeGraphError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeMethodNotAllowed(w)
+		}
+	default:
+		writeBadSegment(w, segments[len(segments)-1])
+	}
+}
+
+func (s *Server) serveCategories(w http.ResponseWriter, r *http.Request, segments []string) {
+	ctx := r.Context()
+	categories := s.Fakes.Categories
+	if !s.authorize(w, r, "MailboxSettings") {
+		return
+	}
+	switch {
+	case len(segments) == 0:
+		switch r.Method {
+		case http.MethodGet:
+			// The filter is ignored, same as MS Graph.
+			objs, err := categories.List(ctx)
+			if err != nil {
+				writeGraphError(w, err)
+				return
+			}
+			s.writeCollection(w, r, objs)
+		case http.MethodPost:
+			var category msgraph.OutlookCategory
+			if !decodeJSON(w, r, &category) {
+				return
+			}
+			obj, err := categories.Create(ctx, &category)
+			if err != nil {
+				writeGraphError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusCreated, obj)
+		default:
+			writeMethodNotAllowed(w)
+		}
+	case len(segments) == 1:
+		id := segments[0]
+		switch r.Method {
+		case http.MethodGet:
+			obj, err := categories.Get(ctx, id)
+			if err != nil {
+				writeGraphError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, obj)
+		case http.MethodPatch:
+			var category msgraph.OutlookCategory
+			if !decodeJSON(w, r, &category) {
+				return
+			}
+			if err := categories.Update(ctx, id, &category); err != nil {
+				writeGraphError(w, err)
+				return
+			}
+			obj, err := categories.Get(ctx, id)
+			if err != nil {
+				writeGraphError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, obj)
+		case http.MethodDelete:
+			if err := categories.Delete(ctx, id); err != nil {
+				writeGraphError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeMethodNotAllowed(w)
+		}
+	default:
+		writeBadSegment(w, segments[len(segments)-1])
+	}
+}
+
+// serveBatch runs the individual requests of the JSON batch in order, where a request whose dependency failed is
+// responded with 424 (Failed Dependency).
+func (s *Server) serveBatch(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	var batch struct {
+		Requests []clients.BatchRequest `json:"requests"`
+	}
+	if !decodeJSON(w, r, &batch) {
+		return
+	}
+	if len(batch.Requests) == 0 || len(batch.Requests) > clients.MaxBatchRequests {
+		writeError(w, http.StatusBadRequest, "BadRequest", fmt.Sprintf("The number of batch requests must be between 1 and %d.", clients.MaxBatchRequests))
+		return
+	}
+
+	status := map[string]int{}
+	var responses []clients.BatchResponse
+	for _, req := range batch.Requests {
+		if req.ID == "" || status[req.ID] != 0 {
+			writeError(w, http.StatusBadRequest, "BadRequest", "The batch request IDs must be unique and not empty.")
+			return
+		}
+		resp := s.serveBatchRequest(r, req, status)
+		status[req.ID] = resp.Status
+		responses = append(responses, resp)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"responses": responses})
+}
+
+func (s *Server) serveBatchRequest(r *http.Request, req clients.BatchRequest, status map[string]int) clients.BatchResponse {
+	for _, dep := range req.DependsOn {
+		if status[dep] == 0 || status[dep] >= 400 {
+			rec := httptest.NewRecorder()
+			writeError(rec, http.StatusFailedDependency, "FailedDependency", fmt.Sprintf("The dependent request %q failed.", dep))
+			return batchResponse(req.ID, rec)
+		}
+	}
+
+	var body []byte
+	if req.Body != nil {
+		body, _ = json.Marshal(req.Body)
+	}
+	sub, err := http.NewRequest(req.Method, s.URL+"/v1.0"+req.URL, bytes.NewReader(body))
+	if err != nil {
+		rec := httptest.NewRecorder()
+		writeError(rec, http.StatusBadRequest, "BadRequest", fmt.Sprintf("Invalid request URL %q.", req.URL))
+		return batchResponse(req.ID, rec)
+	}
+	sub = sub.WithContext(r.Context())
+	for k, v := range req.Headers {
+		sub.Header.Set(k, v)
+	}
+	sub.Header.Set("Authorization", r.Header.Get("Authorization"))
+	rec := httptest.NewRecorder()
+	s.serve(rec, sub)
+	return batchResponse(req.ID, rec)
+}
+
+func batchResponse(id string, rec *httptest.ResponseRecorder) clients.BatchResponse {
+	resp := clients.BatchResponse{ID: id, Status: rec.Code, Headers: map[string]string{}}
+	for k := range rec.Header() {
+		resp.Headers[k] = rec.Header().Get(k)
+	}
+	if b := rec.Body.Bytes(); len(b) != 0 {
+		resp.Body = b
+	}
+	return resp
+}
+
+// authorize checks the access token is granted with the permissions (e.g. "Mail") needed by the request, where the
+// "<permission>.ReadWrite" is needed other than reading.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, permission string) bool {
+	for _, scope := range s.Scopes {
+		if scope == permission+".ReadWrite" || (scope == permission+".Read" && r.Method == http.MethodGet) {
+			return true
+		}
+	}
+	writeError(w, http.StatusForbidden, "ErrorAccessDenied", "Access is denied. Check credentials and try again.")
+	return false
+}
+
+// writeCollection writes a page of the collection, which is specified by the $top and $skip of the request.
+func (s *Server) writeCollection(w http.ResponseWriter, r *http.Request, objs interface{}) {
+	var values []json.RawMessage
+	b, _ := json.Marshal(objs)
+	json.Unmarshal(b, &values)
+
+	query := r.URL.Query()
+	top, skip := s.PageSize, 0
+	if v := query.Get("$top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "ErrorInvalidUrlQuery", fmt.Sprintf("The value '%s' of the query parameter '$top' is invalid.", v))
+			return
+		}
+		top = n
+	}
+	if v := query.Get("$skip"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "ErrorInvalidUrlQuery", fmt.Sprintf("The value '%s' of the query parameter '$skip' is invalid.", v))
+			return
+		}
+		skip = n
+	}
+	if skip > len(values) {
+		skip = len(values)
+	}
+	end := len(values)
+	if top > 0 && skip+top < end {
+		end = skip + top
+	}
+
+	page := map[string]interface{}{
+		"@odata.context": s.URL + "/v1.0/$metadata#" + strings.TrimPrefix(r.URL.Path, "/v1.0/"),
+		"value":          append([]json.RawMessage{}, values[skip:end]...),
+	}
+	if end < len(values) {
+		query.Set("$top", strconv.Itoa(top))
+		query.Set("$skip", strconv.Itoa(end))
+		page["@odata.nextLink"] = s.URL + r.URL.Path + "?" + query.Encode()
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+var displayNameFilterRegexp = regexp.MustCompile(`^displayName eq '((?:[^']|'')*)'$`)
+
+// parseDisplayNameFilter parses the only supported $filter, i.e. "displayName eq '<name>'".
+func parseDisplayNameFilter(w http.ResponseWriter, r *http.Request) (string, bool) {
+	filter := r.URL.Query().Get("$filter")
+	if filter == "" {
+		return "", true
+	}
+	m := displayNameFilterRegexp.FindStringSubmatch(filter)
+	if m == nil {
+		writeError(w, http.StatusBadRequest, "ErrorInvalidUrlQueryFilter", "The query filter contains one or more invalid nodes.")
+		return "", false
+	}
+	return strings.ReplaceAll(m[1], "''", "'"), true
+}
+
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	writeMethodNotAllowed(w)
+	return false
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "RequestBodyRead", fmt.Sprintf("Invalid JSON request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json;odata.metadata=minimal;odata.streaming=true;IEEE754Compatible=false;charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes the error response in the same form as MS Graph, e.g.:
+//
+//	{"error": {"code": "ErrorItemNotFound", "message": "The specified object was not found in the store.", "innerError": {"date": "2020-08-01T00:00:00", "request-id": "...", "client-request-id": "..."}}}
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	requestID := newGUID()
+	w.Header().Set("request-id", requestID)
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+			"innerError": map[string]string{
+				"date":              time.Now().UTC().Format("2006-01-02T15:04:05"),
+				"request-id":        requestID,
+				"client-request-id": requestID,
+			},
+		},
+	})
+}
+
+// writeGraphError writes the error returned by the fakes, which is an msgraph.ErrorResponse.
+func writeGraphError(w http.ResponseWriter, err error) {
+	if errResp, ok := err.(*msgraph.ErrorResponse); ok {
+		writeError(w, errResp.StatusCode(), errResp.ErrorObject.Code, errResp.ErrorObject.Message)
+		return
+	}
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		writeError(w, http.StatusGatewayTimeout, "RequestTimeout", err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, "InternalServerError", err.Error())
+}
+
+func writeBadSegment(w http.ResponseWriter, segment string) {
+	segment, _ = url.PathUnescape(segment)
+	writeError(w, http.StatusBadRequest, "BadRequest", fmt.Sprintf("Resource not found for the segment '%s'.", segment))
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter) {
+	writeError(w, http.StatusMethodNotAllowed, "Request_BadRequest", "Specified HTTP method is not allowed for the request target.")
+}
+
+func newGUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,305 @@
+package graphtest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/magodo/terraform-provider-outlook/msauth"
+	"github.com/magodo/terraform-provider-outlook/outlook/clients"
+	"github.com/magodo/terraform-provider-outlook/outlook/graphtest"
+	"github.com/magodo/terraform-provider-outlook/outlook/utils"
+	msgraph "github.com/yaegashi/msgraph.go/v1.0"
+	"golang.org/x/oauth2"
+)
+
+func newClient(t *testing.T) (*graphtest.Server, *clients.Client) {
+	srv := graphtest.NewServer()
+	t.Cleanup(srv.Close)
+	init := func(context.Context) (oauth2.TokenSource, error) {
+		return msauth.NewStaticTokenSource(srv.AccessToken()), nil
+	}
+	return srv, clients.NewClient(init, nil, srv.URL, "", clients.UserFeature{}, clients.DefaultRetryOptions, clients.DefaultLimitOptions)
+}
+
+func statusCode(err error) int {
+	if errResp, ok := err.(*msgraph.ErrorResponse); ok {
+		return errResp.StatusCode()
+	}
+	return 0
+}
+
+func TestServer_me(t *testing.T) {
+	srv, client := newClient(t)
+	user, err := client.User.Request().Get(context.Background())
+	if err != nil {
+		t.Fatalf("getting user: %+v", err)
+	}
+	if *user.ID != srv.User.ObjectID || *user.UserPrincipalName != srv.User.Username {
+		t.Errorf("unexpected user: %s (%s)", *user.ID, *user.UserPrincipalName)
+	}
+	claims, err := client.TokenClaims()
+	if err != nil {
+		t.Fatalf("decoding token claims: %+v", err)
+	}
+	if claims.TenantID != srv.User.TenantID {
+		t.Errorf("expected tenant %s, got %s", srv.User.TenantID, claims.TenantID)
+	}
+}
+
+func TestServer_unauthorized(t *testing.T) {
+	srv := graphtest.NewServer()
+	defer srv.Close()
+	init := func(context.Context) (oauth2.TokenSource, error) {
+		return msauth.NewStaticTokenSource("foo"), nil
+	}
+	client := clients.NewClient(init, nil, srv.URL, "", clients.UserFeature{}, clients.DefaultRetryOptions, clients.DefaultLimitOptions)
+	_, err := client.MailFolders.Get(context.Background(), "inbox")
+	if statusCode(err) != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %+v", err)
+	}
+}
+
+func TestServer_readOnly(t *testing.T) {
+	srv, client := newClient(t)
+	srv.Scopes = []string{"Mail.Read", "MailboxSettings.Read"}
+	ctx := context.Background()
+	if _, err := client.MailFolders.Get(ctx, "inbox"); err != nil {
+		t.Fatalf("getting inbox: %+v", err)
+	}
+	_, err := client.MailFolders.Create(ctx, "", &msgraph.MailFolder{DisplayName: utils.String("foo")})
+	if statusCode(err) != http.StatusForbidden {
+		t.Fatalf("expected 403, got %+v", err)
+	}
+}
+
+func TestServer_mailFolders(t *testing.T) {
+	_, client := newClient(t)
+	ctx := context.Background()
+
+	folder, err := client.MailFolders.Create(ctx, "", &msgraph.MailFolder{DisplayName: utils.String("John's")})
+	if err != nil {
+		t.Fatalf("creating folder: %+v", err)
+	}
+	if _, err := client.MailFolders.Create(ctx, "", &msgraph.MailFolder{DisplayName: utils.String("John's")}); statusCode(err) != http.StatusConflict {
+		t.Fatalf("expected 409 creating a duplicate folder, got %+v", err)
+	}
+	child, err := client.MailFolders.Create(ctx, *folder.ID, &msgraph.MailFolder{DisplayName: utils.String("child")})
+	if err != nil {
+		t.Fatalf("creating child folder: %+v", err)
+	}
+	if *child.ParentFolderID != *folder.ID {
+		t.Errorf("expected parent %s, got %s", *folder.ID, *child.ParentFolderID)
+	}
+
+	folders, err := client.MailFolders.List(ctx, "", "John's")
+	if err != nil {
+		t.Fatalf("listing folders: %+v", err)
+	}
+	if len(folders) != 1 || *folders[0].ID != *folder.ID {
+		t.Fatalf("expected only the folder %s, got %d folders", *folder.ID, len(folders))
+	}
+	children, err := client.MailFolders.List(ctx, *folder.ID, "")
+	if err != nil {
+		t.Fatalf("listing child folders: %+v", err)
+	}
+	if len(children) != 1 || *children[0].ID != *child.ID {
+		t.Fatalf("expected only the child folder %s, got %d folders", *child.ID, len(children))
+	}
+
+	if err := client.MailFolders.Update(ctx, *child.ID, &msgraph.MailFolder{DisplayName: utils.String("renamed")}); err != nil {
+		t.Fatalf("updating folder: %+v", err)
+	}
+	if child, err = client.MailFolders.Get(ctx, *child.ID); err != nil {
+		t.Fatalf("getting folder: %+v", err)
+	}
+	if *child.DisplayName != "renamed" {
+		t.Errorf("expected display name %q, got %q", "renamed", *child.DisplayName)
+	}
+
+	if err := client.MailFolders.Delete(ctx, *folder.ID); err != nil {
+		t.Fatalf("deleting folder: %+v", err)
+	}
+	if _, err := client.MailFolders.Get(ctx, *child.ID); statusCode(err) != http.StatusNotFound {
+		t.Fatalf("expected 404 getting the child of a deleted folder, got %+v", err)
+	}
+	if err := client.MailFolders.Delete(ctx, "inbox"); statusCode(err) != http.StatusForbidden {
+		t.Fatalf("expected 403 deleting the inbox, got %+v", err)
+	}
+}
+
+func TestServer_moveMessages(t *testing.T) {
+	srv, client := newClient(t)
+	ctx := context.Background()
+
+	folder, err := client.MailFolders.Create(ctx, "", &msgraph.MailFolder{DisplayName: utils.String("foo")})
+	if err != nil {
+		t.Fatalf("creating folder: %+v", err)
+	}
+	srv.Fakes.MailFolders.AddMessages(*folder.ID, 45)
+
+	// The messages span multiple batches.
+	ids, err := client.MailFolders.ListMessageIDs(ctx, *folder.ID)
+	if err != nil {
+		t.Fatalf("listing messages: %+v", err)
+	}
+	if len(ids) != 45 {
+		t.Fatalf("expected 45 messages, got %d", len(ids))
+	}
+	ids = append(ids, "AAMkADnotexist")
+	errs, err := client.MailFolders.MoveMessages(ctx, *folder.ID, ids, "inbox")
+	if err != nil {
+		t.Fatalf("moving messages: %+v", err)
+	}
+	for i, err := range errs[:45] {
+		if err != nil {
+			t.Errorf("moving message %s: %+v", ids[i], err)
+		}
+	}
+	if statusCode(errs[45]) != http.StatusNotFound {
+		t.Errorf("expected 404 moving a nonexistent message, got %+v", errs[45])
+	}
+
+	if ids, err = client.MailFolders.ListMessageIDs(ctx, *folder.ID); err != nil || len(ids) != 0 {
+		t.Fatalf("expected no messages left, got %d (%v)", len(ids), err)
+	}
+	if ids, err = client.MailFolders.ListMessageIDs(ctx, "inbox"); err != nil || len(ids) != 45 {
+		t.Fatalf("expected 45 messages in inbox, got %d (%v)", len(ids), err)
+	}
+}
+
+func TestServer_moveMessagesUnavailable(t *testing.T) {
+	srv, client := newClient(t)
+	ctx := context.Background()
+
+	folder, err := client.MailFolders.Create(ctx, "", &msgraph.MailFolder{DisplayName: utils.String("foo")})
+	if err != nil {
+		t.Fatalf("creating folder: %+v", err)
+	}
+	ids := srv.Fakes.MailFolders.AddMessages(*folder.ID, 3)
+
+	// The first batch fails with 503 after only its first request is executed.
+	var batches int
+	srv.Intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/v1.0/$batch" {
+			return false
+		}
+		batches++
+		if batches > 1 {
+			return false
+		}
+		var batch struct {
+			Requests []clients.BatchRequest `json:"requests"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Fatal(err)
+		}
+		b, _ := json.Marshal(map[string]interface{}{"requests": batch.Requests[:1]})
+		partial := r.Clone(r.Context())
+		partial.Body = ioutil.NopCloser(bytes.NewReader(b))
+		srv.Config.Handler.ServeHTTP(httptest.NewRecorder(), partial)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error": {"code": "ServiceUnavailable", "message": "Service unavailable."}}`))
+		return true
+	}
+
+	// The batch executed partially is not resent, otherwise the executed requests would fail again (e.g. 404).
+	if _, err := client.MailFolders.MoveMessages(ctx, *folder.ID, ids, "inbox"); statusCode(err) != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 moving messages, got %+v", err)
+	}
+	if batches != 2 {
+		t.Fatalf("expected the batch sent once, got %d", batches-1)
+	}
+
+	// The caller moves the remaining messages again.
+	if ids, err = client.MailFolders.ListMessageIDs(ctx, *folder.ID); err != nil || len(ids) != 2 {
+		t.Fatalf("expected 2 messages left, got %d (%v)", len(ids), err)
+	}
+	errs, err := client.MailFolders.MoveMessages(ctx, *folder.ID, ids, "inbox")
+	if err != nil {
+		t.Fatalf("moving messages: %+v", err)
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("moving message %s: %+v", ids[i], err)
+		}
+	}
+	if ids, err = client.MailFolders.ListMessageIDs(ctx, "inbox"); err != nil || len(ids) != 3 {
+		t.Fatalf("expected 3 messages in inbox, got %d (%v)", len(ids), err)
+	}
+}
+
+func TestServer_messageRules(t *testing.T) {
+	_, client := newClient(t)
+	ctx := context.Background()
+
+	rule, err := client.MessageRules.Create(ctx, &msgraph.MessageRule{
+		DisplayName: utils.String("foo"),
+		Sequence:    utils.Int(1),
+		Actions:     &msgraph.MessageRuleActions{MarkAsRead: utils.Bool(true)},
+	})
+	if err != nil {
+		t.Fatalf("creating rule: %+v", err)
+	}
+	if _, err := client.MessageRules.Create(ctx, &msgraph.MessageRule{DisplayName: utils.String("bar"), Sequence: utils.Int(0)}); statusCode(err) != http.StatusBadRequest {
+		t.Fatalf("expected 400 creating a rule of an invalid sequence, got %+v", err)
+	}
+	rules, err := client.MessageRules.List(ctx, "foo")
+	if err != nil {
+		t.Fatalf("listing rules: %+v", err)
+	}
+	if len(rules) != 1 || *rules[0].ID != *rule.ID {
+		t.Fatalf("expected only the rule %s, got %d rules", *rule.ID, len(rules))
+	}
+	if err := client.MessageRules.Update(ctx, *rule.ID, &msgraph.MessageRule{IsEnabled: utils.Bool(false)}); err != nil {
+		t.Fatalf("updating rule: %+v", err)
+	}
+	if rule, err = client.MessageRules.Get(ctx, *rule.ID); err != nil {
+		t.Fatalf("getting rule: %+v", err)
+	}
+	if *rule.IsEnabled || !*rule.Actions.MarkAsRead {
+		t.Errorf("unexpected rule after update: enabled=%t, markAsRead=%t", *rule.IsEnabled, *rule.Actions.MarkAsRead)
+	}
+	if err := client.MessageRules.Delete(ctx, *rule.ID); err != nil {
+		t.Fatalf("deleting rule: %+v", err)
+	}
+	if _, err := client.MessageRules.Get(ctx, *rule.ID); statusCode(err) != http.StatusNotFound {
+		t.Fatalf("expected 404 getting a deleted rule, got %+v", err)
+	}
+}
+
+func TestServer_categories(t *testing.T) {
+	_, client := newClient(t)
+	ctx := context.Background()
+
+	category, err := client.Categories.Create(ctx, &msgraph.OutlookCategory{DisplayName: utils.String("foo")})
+	if err != nil {
+		t.Fatalf("creating category: %+v", err)
+	}
+	if _, err := client.Categories.Create(ctx, &msgraph.OutlookCategory{DisplayName: utils.String("foo")}); statusCode(err) != http.StatusConflict {
+		t.Fatalf("expected 409 creating a duplicate category, got %+v", err)
+	}
+	color := msgraph.CategoryColorVPreset0
+	if err := client.Categories.Update(ctx, *category.ID, &msgraph.OutlookCategory{Color: &color}); err != nil {
+		t.Fatalf("updating category: %+v", err)
+	}
+	categories, err := client.Categories.List(ctx)
+	if err != nil {
+		t.Fatalf("listing categories: %+v", err)
+	}
+	if len(categories) != 1 || *categories[0].Color != color {
+		t.Fatalf("expected only the updated category, got %d categories", len(categories))
+	}
+	if err := client.Categories.Delete(ctx, *category.ID); err != nil {
+		t.Fatalf("deleting category: %+v", err)
+	}
+	if err := client.Categories.Delete(ctx, *category.ID); statusCode(err) != http.StatusNotFound {
+		t.Fatalf("expected 404 deleting a deleted category, got %+v", err)
+	}
+}
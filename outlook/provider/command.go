@@ -0,0 +1,261 @@
+package provider
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/magodo/terraform-provider-outlook/msauth"
+)
+
+// commandFunc runs a subcommand with the provider configuration, and the App synced with the configured token cache.
+// The result is written to "w".
+type commandFunc func(ctx context.Context, d *schema.ResourceData, app *msauth.App, w io.Writer) error
+
+type command struct {
+	synopsis string
+	// setup registers the command specific flags, and returns the function running the command.
+	setup func(fs *flag.FlagSet) commandFunc
+}
+
+var commands = map[string]command{
+	"login": {
+		synopsis: "Sign in via the interactive auth method, and write the token into the token cache",
+		setup:    func(*flag.FlagSet) commandFunc { return runLogin },
+	},
+	"logout": {
+		synopsis: "Remove the cached tokens of the client from the local token cache (the refresh tokens are not revoked)",
+		setup: func(fs *flag.FlagSet) commandFunc {
+			all := fs.Bool("all", false, "Remove the cached tokens of all the clients")
+			return func(ctx context.Context, d *schema.ResourceData, app *msauth.App, w io.Writer) error {
+				return runLogout(ctx, d, app, w, *all)
+			}
+		},
+	},
+	"status": {
+		synopsis: "Show the cached tokens in the token cache",
+		setup:    func(*flag.FlagSet) commandFunc { return runStatus },
+	},
+}
+
+// commandArguments are the provider arguments which can be specified as flags of the subcommands, e.g. `-client-id` for
+// `client_id`. The unspecified ones are sourced from the environment variables as the provider does.
+// The list arguments are specified as comma separated values.
+var commandArguments = []string{
+	"auth_method",
+	"environment",
+	"authority_host",
+	"tenant_id",
+	"client_id",
+	"client_secret",
+	"client_certificate_path",
+	"client_certificate_password",
+	"client_redirect_url",
+	"username",
+	"login_hint",
+	"domain_hint",
+	"prompt",
+	"scopes",
+	"read_only",
+	"token_cache_path",
+	"token_cache_key",
+}
+
+func commandUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, name := range []string{"login", "logout", "status"} {
+		fmt.Fprintf(os.Stderr, "  %-8s%s\n", name, commands[name].synopsis)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of the command.\n", os.Args[0])
+}
+
+// newCommandFlagSet returns the flag set of the subcommand with the flags of the commandArguments, and the function
+// returning the provider configuration specified by those flags, once the flag set is parsed.
+func newCommandFlagSet(p *schema.Provider, name string) (*flag.FlagSet, func() map[string]interface{}) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	flagArguments := map[string]string{}
+	for _, k := range commandArguments {
+		name := strings.ReplaceAll(k, "_", "-")
+		usage := strings.ReplaceAll(p.Schema[k].Description, "`", "")
+		if p.Schema[k].Type == schema.TypeBool {
+			fs.Bool(name, false, usage)
+		} else {
+			fs.String(name, "", usage)
+		}
+		flagArguments[name] = k
+	}
+	return fs, func() map[string]interface{} {
+		raw := map[string]interface{}{}
+		fs.Visit(func(f *flag.Flag) {
+			k, ok := flagArguments[f.Name]
+			if !ok {
+				return
+			}
+			switch p.Schema[k].Type {
+			case schema.TypeList:
+				var values []interface{}
+				for _, v := range strings.Split(f.Value.String(), ",") {
+					if v = strings.TrimSpace(v); v != "" {
+						values = append(values, v)
+					}
+				}
+				raw[k] = values
+			case schema.TypeBool:
+				raw[k] = f.Value.String() == "true"
+			default:
+				raw[k] = f.Value.String()
+			}
+		})
+		return raw
+	}
+}
+
+// RunCommand runs the subcommand of the provider binary, which manages the token cache out of terraform, so that it can
+// be prepared ahead of time (e.g. in CI images). It returns the exit code.
+func RunCommand(args []string) int {
+	if len(args) == 0 {
+		commandUsage()
+		return 2
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		commandUsage()
+		return 2
+	}
+
+	// The interactive prompts are written to the terminal, hence the logs are only needed for debugging.
+	if os.Getenv("TF_LOG") == "" {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	p := Provider()
+	fs, flagConfig := newCommandFlagSet(p, args[0])
+	run := cmd.setup(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	raw := flagConfig()
+
+	// Reuse the provider to build the configuration, which applies the defaults as the provider does.
+	var err error
+	p.ConfigureContextFunc = func(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
+		var app *msauth.App
+		if app, err = newApp(ctx, d); err == nil {
+			err = run(ctx, d, app, os.Stdout)
+		}
+		return nil, nil
+	}
+	config := terraform.NewResourceConfigRaw(raw)
+	diags := p.Validate(config)
+	if !diags.HasError() {
+		diags = p.Configure(context.Background(), config)
+	}
+	if diags.HasError() {
+		for _, d := range diags {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", d.Summary)
+		}
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runLogin(ctx context.Context, d *schema.ResourceData, app *msauth.App, w io.Writer) error {
+	env := expandEnvironment(d)
+	authority := msauth.Authority{Host: env.AuthorityHost, TenantID: d.Get("tenant_id").(string)}
+	clientID := d.Get("client_id").(string)
+	credential, err := expandClientCredential(d)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := withInterrupt(ctx)
+	defer cancel()
+	prompt := &prompter{}
+	scopes := expandScopes(d, env, d.Get("read_only").(bool))
+
+	var client msauth.Client
+	switch method := d.Get("auth_method").(string); method {
+	case AUTH_METHOD_AUTH_CODE_FLOW:
+		client = msauth.NewClientViaAuthorizationCodeFlow(authority, clientID, credential, d.Get("client_redirect_url").(string), prompt.AuthorizationURLCallback, scopes...)
+	case AUTH_METHOD_DEVICE_FLOW:
+		client = msauth.NewClientViaDeviceFlow(authority, clientID, prompt.DeviceAuthorizationCallback, scopes...)
+	case AUTH_METHOD_PASSWORD:
+		// The password is only sourced from the environment variable, rather than a flag visible in the process list.
+		client = msauth.NewClientViaPassword(authority, clientID, credential, d.Get("username").(string), d.Get("password").(string), scopes...)
+	default:
+		return fmt.Errorf("auth method %q is not interactive, whose token is not cached", method)
+	}
+	if err := app.Login(ctx, msauth.WithLoginOptions(client, expandLoginOptions(d))); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "Logged in, the token is written into the token cache.")
+	return nil
+}
+
+// runLogout removes the cached tokens from the token cache. The refresh tokens are not revoked, as the Microsoft identity
+// platform doesn't support revoking a single refresh token.
+func runLogout(ctx context.Context, d *schema.ResourceData, app *msauth.App, w io.Writer, all bool) error {
+	env := expandEnvironment(d)
+	authority := msauth.Authority{Host: env.AuthorityHost, TenantID: d.Get("tenant_id").(string)}
+	clientID := d.Get("client_id").(string)
+	loginHint := d.Get("login_hint").(string)
+	n, err := app.RemoveCacheEntries(ctx, func(entry msauth.CacheEntry) bool {
+		if all {
+			return true
+		}
+		if entry.ClientID != clientID || entry.TokenURL != authority.Endpoint().TokenURL {
+			return false
+		}
+		// Only the tokens of the account are removed, if specified.
+		return loginHint == "" || (entry.Account != nil && strings.EqualFold(entry.Account.Username, loginHint))
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Removed %d cached token(s).\n", n)
+	return nil
+}
+
+func runStatus(ctx context.Context, d *schema.ResourceData, app *msauth.App, w io.Writer) error {
+	entries := app.CacheEntries()
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No token is cached.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLIENT ID\tTOKEN URL\tACCOUNT\tSCOPES\tACCESS TOKEN EXPIRY\tREFRESH TOKEN")
+	for _, entry := range entries {
+		clientID := entry.ClientID
+		if clientID == "" {
+			clientID = entry.ID
+		}
+		expiry := entry.Expiry.Local().Format(time.RFC3339)
+		if entry.Expiry.Before(time.Now()) {
+			expiry += " (expired)"
+		}
+		account := "(unknown)"
+		if entry.Account != nil {
+			account = entry.Account.Username
+		}
+		refreshToken := "no"
+		if entry.HasRefreshToken {
+			refreshToken = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", clientID, entry.TokenURL, account, strings.Join(entry.Scopes, " "), expiry, refreshToken)
+	}
+	return tw.Flush()
+}
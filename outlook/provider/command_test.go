@@ -0,0 +1,114 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/magodo/terraform-provider-outlook/msauth"
+	"github.com/magodo/terraform-provider-outlook/msauth/authtest"
+)
+
+func TestNewCommandFlagSet(t *testing.T) {
+	fs, config := newCommandFlagSet(Provider(), "login")
+	all := fs.Bool("all", false, "")
+	if err := fs.Parse([]string{"-client-id", "foo", "-scopes", "Mail.Read, offline_access,", "-read-only", "-login-hint", "john@contoso.com", "-all"}); err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]interface{}{
+		"client_id":  "foo",
+		"scopes":     []interface{}{"Mail.Read", "offline_access"},
+		"read_only":  true,
+		"login_hint": "john@contoso.com",
+	}
+	if raw := config(); !reflect.DeepEqual(raw, expect) {
+		t.Fatalf("expect %v, got %v", expect, raw)
+	}
+	if !*all {
+		t.Fatal("expect the command specific flag to be parsed")
+	}
+}
+
+// newCommandApp returns an App synced with the store, as the one passed to the commands.
+func newCommandApp(t *testing.T, store msauth.TokenCacheStore) *msauth.App {
+	app := msauth.NewApp()
+	if err := app.SyncCache(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestRunCommand_tokenCache(t *testing.T) {
+	server := authtest.NewServer()
+	defer server.Close()
+	server.Passwords["alice@contoso.com"] = "alice"
+	server.Passwords[authtest.DefaultUser.Username] = "john"
+
+	store := msauth.NewMemoryTokenCacheStore()
+	ctx := context.Background()
+	config := func(raw map[string]interface{}) *schema.ResourceData {
+		raw["authority_host"] = server.URL
+		raw["tenant_id"] = authtest.DefaultTenantID
+		raw["client_id"] = "client"
+		return schema.TestResourceDataRaw(t, Provider().Schema, raw)
+	}
+
+	for username, password := range server.Passwords {
+		var out bytes.Buffer
+		d := config(map[string]interface{}{"auth_method": AUTH_METHOD_PASSWORD, "username": username, "password": password})
+		if err := runLogin(ctx, d, newCommandApp(t, store), &out); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), "Logged in") {
+			t.Fatalf("unexpected output of login: %s", out.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := runStatus(ctx, config(map[string]interface{}{}), newCommandApp(t, store), &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"client", "alice@contoso.com", authtest.DefaultUser.Username, "offline_access"} {
+		if !strings.Contains(out.String(), s) {
+			t.Fatalf("expect %q in the output of status, got:\n%s", s, out.String())
+		}
+	}
+
+	// Only the tokens of the account of the login hint are removed.
+	out.Reset()
+	if err := runLogout(ctx, config(map[string]interface{}{"login_hint": "ALICE@contoso.com"}), newCommandApp(t, store), &out, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Removed 1 cached token(s).") {
+		t.Fatalf("unexpected output of logout: %s", out.String())
+	}
+	entries := newCommandApp(t, store).CacheEntries()
+	if len(entries) != 1 || entries[0].Account == nil || entries[0].Account.Username != authtest.DefaultUser.Username {
+		t.Fatalf("expect only the token of %s left, got %+v", authtest.DefaultUser.Username, entries)
+	}
+
+	// The tokens of other clients are kept, unless all are removed.
+	out.Reset()
+	d := config(map[string]interface{}{})
+	d.Set("client_id", "another")
+	if err := runLogout(ctx, d, newCommandApp(t, store), &out, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Removed 0 cached token(s).") {
+		t.Fatalf("unexpected output of logout: %s", out.String())
+	}
+	out.Reset()
+	if err := runLogout(ctx, d, newCommandApp(t, store), &out, true); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := runStatus(ctx, d, newCommandApp(t, store), &out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(out.String()) != "No token is cached." {
+		t.Fatalf("unexpected output of status: %s", out.String())
+	}
+}
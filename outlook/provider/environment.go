@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/magodo/terraform-provider-outlook/msauth"
+)
+
+type environment struct {
+	AuthorityHost string
+	GraphEndpoint string
+}
+
+// environments fetched from https://docs.microsoft.com/en-us/graph/deployments#microsoft-graph-and-graph-explorer-service-root-endpoints
+var environments = map[string]environment{
+	"public": {
+		AuthorityHost: msauth.AuthorityHostPublic,
+		GraphEndpoint: "https://graph.microsoft.com",
+	},
+	"usgovernment": {
+		AuthorityHost: msauth.AuthorityHostUSGovernment,
+		GraphEndpoint: "https://graph.microsoft.us",
+	},
+	"usgovernmentdod": {
+		AuthorityHost: msauth.AuthorityHostUSGovernment,
+		GraphEndpoint: "https://dod-graph.microsoft.us",
+	},
+	"china": {
+		AuthorityHost: msauth.AuthorityHostChina,
+		GraphEndpoint: "https://microsoftgraph.chinacloudapi.cn",
+	},
+}
+
+func environmentNames() []string {
+	names := make([]string, 0, len(environments))
+	for name := range environments {
+		names = append(names, name)
+	}
+	return names
+}
+
+// expandEnvironment returns the configured environment, with the endpoints overridden by the provider configuration.
+func expandEnvironment(d *schema.ResourceData) environment {
+	env := environments[d.Get("environment").(string)]
+	if v := d.Get("authority_host").(string); v != "" {
+		env.AuthorityHost = v
+	}
+	if v := d.Get("graph_endpoint").(string); v != "" {
+		env.GraphEndpoint = strings.TrimSuffix(v, "/")
+	}
+	return env
+}
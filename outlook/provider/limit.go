@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/magodo/terraform-provider-outlook/outlook/clients"
+)
+
+var requestBudgetSchema = &schema.Schema{
+	Type:     schema.TypeList,
+	Optional: true,
+	MaxItems: 1,
+	MinItems: 1,
+	Elem: &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"requests": {
+				Type:         schema.TypeInt,
+				Description:  "The maximum number of the requests sent to the mailbox within any `window`.",
+				Required:     true,
+				ValidateFunc: validation.IntAtLeast(1),
+			},
+			"window": {
+				Type:         schema.TypeString,
+				Description:  "The length of the window, e.g. `10m`.",
+				Optional:     true,
+				Default:      clients.DefaultLimitOptions.Window.String(),
+				ValidateFunc: validateDuration,
+			},
+		},
+	},
+	Description: "The budget of the requests sent to the mailbox within a sliding window. Unlimited if absent.",
+}
+
+func expandLimitOptions(maxConcurrentRequests int, input []interface{}) clients.LimitOptions {
+	options := clients.DefaultLimitOptions
+	options.MaxConcurrentRequests = maxConcurrentRequests
+	if len(input) == 0 || input[0] == nil {
+		return options
+	}
+	raw := input[0].(map[string]interface{})
+	options.RequestsPerWindow = raw["requests"].(int)
+	// The window is validated by the schema.
+	options.Window, _ = time.ParseDuration(raw["window"].(string))
+	return options
+}
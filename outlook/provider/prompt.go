@@ -0,0 +1,92 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/magodo/terraform-provider-outlook/msauth"
+	"github.com/pkg/browser"
+)
+
+// prompter shows the interactive login prompts to the user.
+//
+// Terraform only shows the diagnostics of the provider after the RPC returns, which is too late for the interactive login.
+// Meanwhile, the stdout and stderr of the provider are captured by Terraform. Hence the prompts are written to the
+// controlling terminal directly if any, and also logged for the case there is none (e.g. in CI).
+type prompter struct {
+	mutex sync.Mutex
+	// messages are all the prompts shown so far, which are attached to the diagnostic if the login fails.
+	messages []string
+}
+
+func (p *prompter) Printf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	p.mutex.Lock()
+	p.messages = append(p.messages, msg)
+	p.mutex.Unlock()
+
+	log.Printf("[INFO] %s", msg)
+	if tty := openTerminal(); tty != nil {
+		defer tty.Close()
+		fmt.Fprintf(tty, "\n%s\n\n", msg)
+	}
+}
+
+// String returns all the prompts shown so far.
+func (p *prompter) String() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return strings.Join(p.messages, "\n")
+}
+
+func (p *prompter) DeviceAuthorizationCallback(auth msauth.DeviceAuthorizationAuth) error {
+	p.Printf("To sign in, use a web browser to open %s and enter the code %s to authenticate (with in %d sec).", auth.VerificationURI, auth.UserCode, auth.ExpiresIn)
+	return nil
+}
+
+func (p *prompter) AuthorizationURLCallback(authURL string) error {
+	p.Printf("To sign in, a web browser is opened to visit the following URL. If it is not opened, please open it manually:\n\n%s", authURL)
+	if err := browser.OpenURL(authURL); err != nil {
+		log.Printf("[WARN] opening web browser: %v", err)
+	}
+	return nil
+}
+
+// openTerminal opens the controlling terminal for writing, it returns nil if there is none.
+func openTerminal() io.WriteCloser {
+	name := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		name = "CONOUT$"
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return nil
+	}
+	return f
+}
+
+// withInterrupt returns a copy of ctx that is also canceled once the process receives an interrupt (i.e. Ctrl-C),
+// so that the interactive login is aborted promptly. The returned function must be called to release the resources.
+func withInterrupt(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt)
+	go func() {
+		select {
+		case <-ch:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(ch)
+		cancel()
+	}
+}
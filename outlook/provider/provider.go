@@ -2,10 +2,9 @@ package provider
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log"
-	"os"
+	"strings"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
@@ -13,13 +12,17 @@ import (
 	"github.com/magodo/terraform-provider-outlook/msauth"
 	"github.com/magodo/terraform-provider-outlook/outlook/clients"
 	"github.com/magodo/terraform-provider-outlook/outlook/services"
-	msgraph "github.com/yaegashi/msgraph.go/v1.0"
+	"github.com/magodo/terraform-provider-outlook/outlook/utils"
 	"golang.org/x/oauth2"
 )
 
 const (
-	AUTH_METHOD_AUTH_CODE_FLOW = "auth_code_flow"
-	AUTH_METHOD_DEVICE_FLOW    = "device_flow"
+	AUTH_METHOD_AUTH_CODE_FLOW     = "auth_code_flow"
+	AUTH_METHOD_DEVICE_FLOW        = "device_flow"
+	AUTH_METHOD_CLIENT_CREDENTIALS = "client_credentials"
+	AUTH_METHOD_FEDERATED_TOKEN    = "federated_token"
+	AUTH_METHOD_AUTO               = "auto"
+	AUTH_METHOD_PASSWORD           = "password"
 )
 
 func SupportedResources() map[string]*schema.Resource {
@@ -34,6 +37,7 @@ func SupportedDataSources() map[string]*schema.Resource {
 	return map[string]*schema.Resource{
 		"outlook_mail_folder": services.DataSourceMailFolder(),
 		"outlook_category":    services.DataSourceOutlookCategory(),
+		"outlook_me":          services.DataSourceMe(),
 	}
 }
 
@@ -48,8 +52,39 @@ func Provider() *schema.Provider {
 				ValidateFunc: validation.StringInSlice([]string{
 					AUTH_METHOD_AUTH_CODE_FLOW,
 					AUTH_METHOD_DEVICE_FLOW,
+					AUTH_METHOD_CLIENT_CREDENTIALS,
+					AUTH_METHOD_FEDERATED_TOKEN,
+					AUTH_METHOD_AUTO,
+					AUTH_METHOD_PASSWORD,
 				}, false),
 			},
+			"tenant_id": {
+				Type:        schema.TypeString,
+				Description: "The AzureAD tenant ID to authenticate against. The client credentials flow requires a specific tenant.",
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("OUTLOOK_TENANT_ID", "common"),
+			},
+			"environment": {
+				Type:         schema.TypeString,
+				Description:  "The cloud environment to use. Possible values are `public`, `usgovernment`, `usgovernmentdod` and `china`.",
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("OUTLOOK_ENVIRONMENT", "public"),
+				ValidateFunc: validation.StringInSlice(environmentNames(), false),
+			},
+			"authority_host": {
+				Type:         schema.TypeString,
+				Description:  "The base URL of the login service, which overrides the one of the `environment`.",
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("OUTLOOK_AUTHORITY_HOST", nil),
+				ValidateFunc: validation.IsURLWithHTTPorHTTPS,
+			},
+			"graph_endpoint": {
+				Type:         schema.TypeString,
+				Description:  "The base URL of MS Graph (without the API version), which overrides the one of the `environment`.",
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("OUTLOOK_GRAPH_ENDPOINT", nil),
+				ValidateFunc: validation.IsURLWithHTTPorHTTPS,
+			},
 			"client_id": {
 				Type:        schema.TypeString,
 				Description: "The AzureAD registered application's Object ID (i.e. oauth2 client_id)",
@@ -62,19 +97,132 @@ func Provider() *schema.Provider {
 				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("OUTLOOK_CLIENT_SECRET", ""),
 			},
+			"client_certificate_path": {
+				Type:        schema.TypeString,
+				Description: "The path to a PEM or PFX encoded certificate (including the private key) of the AzureAD registered application, which is used to authenticate the application instead of `client_secret`.",
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("OUTLOOK_CLIENT_CERTIFICATE_PATH", ""),
+			},
+			"client_certificate_password": {
+				Type:        schema.TypeString,
+				Description: "The password to decrypt the certificate specified by `client_certificate_path`.",
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("OUTLOOK_CLIENT_CERTIFICATE_PASSWORD", ""),
+			},
+			"federated_token_file": {
+				Type:        schema.TypeString,
+				Description: "The path to a file containing the OIDC token issued by an external identity provider, which is trusted by the AzureAD registered application via workload identity federation.",
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("AZURE_FEDERATED_TOKEN_FILE", ""),
+			},
+			"federated_token_env_var": {
+				Type:        schema.TypeString,
+				Description: "The name of the environment variable containing the OIDC token, which is an alternative to `federated_token_file`.",
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("OUTLOOK_FEDERATED_TOKEN_ENV_VAR", ""),
+			},
 			"client_redirect_url": {
 				Type:        schema.TypeString,
 				Description: "The AzureAD registered application's redirect URL",
 				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("OUTLOOK_CLIENT_REDIRECT_URL", "http://localhost:3000/"),
 			},
+			"username": {
+				Type:        schema.TypeString,
+				Description: "The username of the user signing in by the `password` auth method.",
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("OUTLOOK_USERNAME", ""),
+			},
+			"password": {
+				Type:        schema.TypeString,
+				Description: "The password of the user signing in by the `password` auth method.",
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("OUTLOOK_PASSWORD", ""),
+			},
+			"login_hint": {
+				Type:        schema.TypeString,
+				Description: "The username of the account to sign in by the interactive auth methods, e.g. `john@contoso.com`. It selects the cached token of the account, so that several providers can be bound to different accounts.",
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("OUTLOOK_LOGIN_HINT", ""),
+			},
+			"domain_hint": {
+				Type:        schema.TypeString,
+				Description: "The domain hint of the authorization code flow, which skips the home realm discovery on the sign-in page, e.g. `consumers`, `organizations` or the domain of a tenant.",
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("OUTLOOK_DOMAIN_HINT", ""),
+			},
+			"prompt": {
+				Type:         schema.TypeString,
+				Description:  "The type of user interaction required on the sign-in page of the authorization code flow.",
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("OUTLOOK_PROMPT", nil),
+				ValidateFunc: validation.StringInSlice([]string{"login", "select_account", "consent", "none"}, false),
+			},
 			"token_cache_path": {
 				Type:        schema.TypeString,
 				Description: "Token cache file path that the provider will export the token info into this file for reuse. Accordingly, the provider will try to load the token from this file if file exists.",
 				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("OUTLOOK_TOKEN_CACHE_PATH", ".terraform-provider-outlook.json"),
 			},
-			"feature": featureSchema,
+			"user_id": {
+				Type:        schema.TypeString,
+				Description: "The object ID of the user whose mailbox is managed. Defaults to the signed-in user. Required for the client credentials flow.",
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("OUTLOOK_USER_ID", ""),
+			},
+			"user_principal_name": {
+				Type:        schema.TypeString,
+				Description: "The user principal name of the user whose mailbox is managed. This is an alternative to `user_id`.",
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("OUTLOOK_USER_PRINCIPAL_NAME", ""),
+			},
+			"access_token": {
+				Type:        schema.TypeString,
+				Description: "A pre-obtained access token for MS Graph, which is used instead of running the auth method. The token is not refreshed.",
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("OUTLOOK_ACCESS_TOKEN", ""),
+			},
+			"credential_command": {
+				Type:        schema.TypeList,
+				Description: "An external command (and its arguments) which writes an access token for MS Graph in JSON to stdout, which is used instead of running the auth method. The command is invoked again before the token expires.",
+				Optional:    true,
+				MinItems:    1,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"scopes": {
+				Type:        schema.TypeList,
+				Description: "The delegated scopes requested by the interactive auth methods. Defaults to the scopes derived from the supported resources and data sources.",
+				Optional:    true,
+				MinItems:    1,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"read_only": {
+				Type:        schema.TypeBool,
+				Description: "Whether to only request the read-only variants of the automatically derived scopes, e.g. for running `terraform plan` only.",
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("OUTLOOK_READ_ONLY", false),
+			},
+			"token_cache": tokenCacheSchema,
+			"token_cache_key": {
+				Type:        schema.TypeString,
+				Description: "The passphrase to encrypt the token cache file. An existing plain token cache file will be encrypted on first use.",
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("OUTLOOK_TOKEN_CACHE_KEY", ""),
+			},
+			"retry": retrySchema,
+			"max_concurrent_requests": {
+				Type:         schema.TypeInt,
+				Description:  "The maximum number of the concurrent requests sent to the mailbox, which is shared by all the provider instances targeting the same mailbox.",
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("OUTLOOK_MAX_CONCURRENT_REQUESTS", clients.DefaultLimitOptions.MaxConcurrentRequests),
+				ValidateFunc: validation.IntAtLeast(1),
+			},
+			"request_budget": requestBudgetSchema,
+			"feature":        featureSchema,
 		},
 
 		DataSourcesMap: SupportedDataSources(),
@@ -87,62 +235,328 @@ func Provider() *schema.Provider {
 }
 
 func providerConfigure(p *schema.Provider) schema.ConfigureContextFunc {
-	return func(ctx context.Context, d *schema.ResourceData) (meta interface{}, diags diag.Diagnostics) {
-		var (
-			clientID     = d.Get("client_id").(string)
-			clientSecret = d.Get("client_secret").(string)
-			redirectURL  = d.Get("client_redirect_url").(string)
-			tenantID     = "common"
-		)
-		scopes := []string{
-			"mailboxsettings.readwrite",
-			"mail.readwrite",
-			"offline_access",
+	return func(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
+		userID := d.Get("user_id").(string)
+
+		env := expandEnvironment(d)
+
+		if upn := d.Get("user_principal_name").(string); upn != "" {
+			if userID != "" {
+				return nil, diag.Errorf("only one of `user_id` and `user_principal_name` can be specified")
+			}
+			userID = upn
 		}
-		app := msauth.NewApp()
 
-		// Import token cache if specified, accordingly export the updated token cache at the end of configuring provider.
-		tokenCachePath := d.Get("token_cache_path").(string)
-		err := app.ImportCache(tokenCachePath)
-		if err != nil {
-			if errors.Is(err, os.ErrNotExist) {
-				defer func() {
-					if !diags.HasError() {
-						if err := app.ExportCache(tokenCachePath); err != nil {
-							diags = diag.FromErr(err)
-						}
+		accessToken, command := d.Get("access_token").(string), d.Get("credential_command").([]interface{})
+		if accessToken != "" && len(command) != 0 {
+			return nil, diag.Errorf("only one of `access_token` and `credential_command` can be specified")
+		}
+
+		// The configuration is validated in advance, while the login is deferred until the first request to MS Graph,
+		// so that the commands not talking to MS Graph (e.g. `terraform validate`) never prompt for login.
+		var credential msauth.ClientCredential
+		if accessToken == "" && len(command) == 0 {
+			var diags diag.Diagnostics
+			if credential, diags = validateAuthMethod(d, userID); diags.HasError() {
+				return nil, diags
+			}
+		}
+		initTokenSource := func(readOnly bool) clients.TokenSourceFunc {
+			return func(ctx context.Context) (oauth2.TokenSource, error) {
+				var ts oauth2.TokenSource
+				switch {
+				case accessToken != "":
+					ts = msauth.NewStaticTokenSource(accessToken)
+				case len(command) != 0:
+					ts = msauth.NewCommandTokenSource(*utils.ExpandSlice(command, "", nil).(*[]string)...)
+				default:
+					var err error
+					if ts, err = obtainTokenSource(ctx, d, env, userID, credential, readOnly); err != nil {
+						return nil, err
 					}
-				}()
-			} else {
-				return nil, diag.FromErr(err)
+				}
+				if err := validateToken(ctx, d, ts, readOnly); err != nil {
+					return nil, err
+				}
+				return ts, nil
 			}
 		}
+		var initReadTokenSource clients.TokenSourceFunc
+		if readOnlyUntilWrite(d) {
+			initReadTokenSource = initTokenSource(true)
+		}
+
+		retry, err := expandRetryOptions(d.Get("retry").([]interface{}))
+		if err != nil {
+			return nil, diag.FromErr(err)
+		}
+
+		limit := expandLimitOptions(d.Get("max_concurrent_requests").(int), d.Get("request_budget").([]interface{}))
+
+		feature := expandFeature(d.Get("feature").([]interface{}))
+		return clients.NewClient(initTokenSource(d.Get("read_only").(bool)), initReadTokenSource, env.GraphEndpoint, userID, feature, retry, limit), nil
+	}
+}
+
+// validateAuthMethod validates the provider configuration of the configured auth method, and returns the credential of
+// the AzureAD registered application.
+func validateAuthMethod(d *schema.ResourceData, userID string) (msauth.ClientCredential, diag.Diagnostics) {
+	var (
+		clientSecret = d.Get("client_secret").(string)
+		certPath     = d.Get("client_certificate_path").(string)
+		tenantID     = d.Get("tenant_id").(string)
+	)
+
+	credential, err := expandClientCredential(d)
+	if err != nil {
+		return nil, diag.FromErr(err)
+	}
+	federatedToken, err := expandFederatedToken(d)
+	if err != nil {
+		return nil, diag.FromErr(err)
+	}
+
+	switch d.Get("auth_method").(string) {
+	case AUTH_METHOD_AUTH_CODE_FLOW, AUTH_METHOD_DEVICE_FLOW, AUTH_METHOD_AUTO:
+	case AUTH_METHOD_CLIENT_CREDENTIALS:
+		if diags := validateAppOnlyAuth(AUTH_METHOD_CLIENT_CREDENTIALS, userID, tenantID); diags.HasError() {
+			return nil, diags
+		}
+		if clientSecret == "" && certPath == "" {
+			return nil, diag.Errorf("either `client_secret` or `client_certificate_path` must be specified for auth method %q", AUTH_METHOD_CLIENT_CREDENTIALS)
+		}
+	case AUTH_METHOD_FEDERATED_TOKEN:
+		if diags := validateAppOnlyAuth(AUTH_METHOD_FEDERATED_TOKEN, userID, tenantID); diags.HasError() {
+			return nil, diags
+		}
+		if federatedToken == nil {
+			return nil, diag.Errorf("either `federated_token_file` or `federated_token_env_var` must be specified for auth method %q", AUTH_METHOD_FEDERATED_TOKEN)
+		}
+	case AUTH_METHOD_PASSWORD:
+		if d.Get("username").(string) == "" || d.Get("password").(string) == "" {
+			return nil, diag.Errorf("both `username` and `password` must be specified for auth method %q", AUTH_METHOD_PASSWORD)
+		}
+		// The personal Microsoft accounts can't sign in by password.
+		if tenantID == "common" || tenantID == "consumers" {
+			return nil, diag.Errorf("either `organizations` or a specific `tenant_id` must be specified for auth method %q", AUTH_METHOD_PASSWORD)
+		}
+	default:
+		return nil, diag.FromErr(fmt.Errorf("Unknown auth method: %s", d.Get("auth_method").(string)))
+	}
+	return credential, nil
+}
 
-		var ts oauth2.TokenSource
+// obtainTokenSource obtains the token source via the configured auth method (validated by validateAuthMethod), with the
+// tokens cached in the token cache. The delegated scopes derived automatically are the read-only variants if "readOnly".
+// It runs on the first request to MS Graph, whose context (e.g. canceled as Terraform stops the provider) aborts the
+// login.
+func obtainTokenSource(ctx context.Context, d *schema.ResourceData, env environment, userID string, credential msauth.ClientCredential, readOnly bool) (oauth2.TokenSource, error) {
+	var (
+		clientID    = d.Get("client_id").(string)
+		redirectURL = d.Get("client_redirect_url").(string)
+		tenantID    = d.Get("tenant_id").(string)
+	)
+	authority := msauth.Authority{Host: env.AuthorityHost, TenantID: tenantID}
 
-		switch d.Get("auth_method").(string) {
+	scopes := expandScopes(d, env, readOnly)
+	app, err := newApp(ctx, d)
+	if err != nil {
+		return nil, err
+	}
 
-		case AUTH_METHOD_AUTH_CODE_FLOW:
-			ts, err = app.ObtainTokenSourceViaAuthorizationCodeFlow(context.Background(), tenantID, clientID, clientSecret, redirectURL, scopes...)
+	var ts oauth2.TokenSource
 
-		case AUTH_METHOD_DEVICE_FLOW:
-			ts, err = app.ObtainTokenSourceViaDeviceFlow(context.Background(), tenantID, clientID,
-				func(auth msauth.DeviceAuthorizationAuth) error {
-					// Currently there is no way for a provider to print messsage to user's console unless using debug message.
-					log.Printf("[INFO] To sign in, use a web browser to open %s and enter the code %s to authenticate (with in %d sec)", auth.VerificationURI, auth.UserCode, auth.ExpiresIn)
-					return nil
-				},
-				scopes...,
-			)
-		default:
-			return nil, diag.FromErr(fmt.Errorf("Unknown auth method: %s", d.Get("auth_method").(string)))
+	// The interactive login is also aborted by Ctrl-C.
+	ctx, cancel := withInterrupt(ctx)
+	defer cancel()
+	prompt := &prompter{}
+
+	switch d.Get("auth_method").(string) {
+
+	case AUTH_METHOD_AUTH_CODE_FLOW:
+		client := msauth.NewClientViaAuthorizationCodeFlow(authority, clientID, credential, redirectURL, prompt.AuthorizationURLCallback, scopes...)
+		ts, err = app.ObtainTokenSourceViaClient(ctx, msauth.WithLoginOptions(client, expandLoginOptions(d)))
+
+	case AUTH_METHOD_DEVICE_FLOW:
+		client := msauth.NewClientViaDeviceFlow(authority, clientID, prompt.DeviceAuthorizationCallback, scopes...)
+		ts, err = app.ObtainTokenSourceViaClient(ctx, msauth.WithLoginOptions(client, expandLoginOptions(d)))
+
+	case AUTH_METHOD_CLIENT_CREDENTIALS:
+		ts, err = app.ObtainTokenSourceViaClientCredential(ctx, authority, clientID, credential, env.GraphEndpoint+"/.default")
+
+	case AUTH_METHOD_FEDERATED_TOKEN:
+		var federatedToken *msauth.FederatedToken
+		if federatedToken, err = expandFederatedToken(d); err != nil {
+			return nil, err
 		}
+		ts, err = app.ObtainTokenSourceViaClientCredential(ctx, authority, clientID, federatedToken, env.GraphEndpoint+"/.default")
 
-		if err != nil {
-			return nil, diag.FromErr(err)
+	case AUTH_METHOD_PASSWORD:
+		username, password := d.Get("username").(string), d.Get("password").(string)
+		log.Printf("[WARN] auth method %q is only meant for the tests in a dedicated tenant, not for production", AUTH_METHOD_PASSWORD)
+		ts, err = app.ObtainTokenSourceViaClient(ctx, msauth.NewClientViaPassword(authority, clientID, credential, username, password, scopes...))
+
+	case AUTH_METHOD_AUTO:
+		var chain *msauth.ChainedCredential
+		if chain, err = newChainedCredential(d, app, authority, credential, env, userID, scopes, prompt); err != nil {
+			return nil, err
 		}
+		ts, err = chain.ObtainTokenSource(ctx)
 
-		feature := expandFeature(d.Get("feature").([]interface{}))
-		return clients.NewClient(msgraph.NewClient(oauth2.NewClient(context.Background(), ts)).BaseRequestBuilder, feature), nil
+	default:
+		return nil, fmt.Errorf("Unknown auth method: %s", d.Get("auth_method").(string))
+	}
+
+	if err != nil {
+		// The prompts are attached, e.g. the user may need the device code to find the failed login.
+		if msg := prompt.String(); msg != "" {
+			return nil, fmt.Errorf("authenticating to MS Graph: %w\n\n%s", err, msg)
+		}
+		return nil, fmt.Errorf("authenticating to MS Graph: %w", err)
+	}
+	return ts, nil
+}
+
+// newChainedCredential builds the credential chain of the "auto" auth method, which tries (in order) the client
+// credentials flow with the client secret or certificate, the client credentials flow with the federated token, the
+// cached token, and finally the interactive login.
+func newChainedCredential(d *schema.ResourceData, app *msauth.App, authority msauth.Authority, credential msauth.ClientCredential, env environment, userID string, scopes []string, prompt *prompter) (*msauth.ChainedCredential, error) {
+	clientID := d.Get("client_id").(string)
+	confidential := d.Get("client_secret").(string) != "" || d.Get("client_certificate_path").(string) != ""
+	federatedToken, err := expandFederatedToken(d)
+	if err != nil {
+		return nil, err
+	}
+
+	// The app-only credentials are only available if the mailbox and the tenant are specified.
+	var appOnlyUnavailable msauth.Credential
+	if diags := validateAppOnlyAuth(AUTH_METHOD_AUTO, userID, authority.TenantID); diags.HasError() {
+		appOnlyUnavailable = msauth.UnavailableCredential(diags[0].Summary)
+	}
+
+	chain := msauth.NewChainedCredential()
+	switch {
+	case !confidential:
+		chain.Append("client secret or certificate", msauth.UnavailableCredential("neither `client_secret` nor `client_certificate_path` is specified"))
+	case appOnlyUnavailable != nil:
+		chain.Append("client secret or certificate", appOnlyUnavailable)
+	default:
+		chain.Append("client secret or certificate", msauth.NewClientCredentialClient(authority, clientID, credential, env.GraphEndpoint+"/.default"))
+	}
+	switch {
+	case federatedToken == nil:
+		chain.Append("federated token", msauth.UnavailableCredential("neither `federated_token_file` nor `federated_token_env_var` is specified"))
+	case appOnlyUnavailable != nil:
+		chain.Append("federated token", appOnlyUnavailable)
+	default:
+		chain.Append("federated token", msauth.NewClientCredentialClient(authority, clientID, federatedToken, env.GraphEndpoint+"/.default"))
+	}
+
+	// The device flow doesn't support confidential clients, which log in via the authorization code flow instead.
+	// Both share the same cached token.
+	var client msauth.Client
+	if confidential {
+		client = msauth.NewClientViaAuthorizationCodeFlow(authority, clientID, credential, d.Get("client_redirect_url").(string), prompt.AuthorizationURLCallback, scopes...)
+	} else {
+		client = msauth.NewClientViaDeviceFlow(authority, clientID, prompt.DeviceAuthorizationCallback, scopes...)
+	}
+	client = msauth.WithLoginOptions(client, expandLoginOptions(d))
+	chain.Append("cached token", app.NewCachedCredential(client))
+
+	// Nobody can respond to the interactive login without a terminal (e.g. in CI), which would otherwise wait until
+	// the login expires.
+	if tty := openTerminal(); tty == nil {
+		chain.Append("interactive login", msauth.UnavailableCredential("no terminal is attached for the interactive login"))
+	} else {
+		tty.Close()
+		chain.Append("interactive login", app.NewInteractiveCredential(client))
+	}
+	return chain, nil
+}
+
+// validateToken obtains the access token, and warns about the permissions it is not granted with. It doesn't fail, as the
+// permissions are only needed by the resources and data sources in use, which are unknown to the provider.
+func validateToken(ctx context.Context, d *schema.ResourceData, ts oauth2.TokenSource, readOnly bool) error {
+	t, err := msauth.TokenWithContext(ctx, ts)
+	if err != nil {
+		return fmt.Errorf("obtaining access token: %w", err)
+	}
+	claims, err := msauth.AccessTokenClaims(t)
+	if err != nil {
+		// E.g. the access token of personal Microsoft accounts is opaque.
+		log.Printf("[DEBUG] skip validating the access token: %v", err)
+		return nil
+	}
+	log.Printf("[INFO] authenticated as %q (object ID: %s) in tenant %s", claims.Username(), claims.ObjectID, claims.TenantID)
+	if len(claims.Permissions()) == 0 {
+		return nil
+	}
+	if missing := claims.MissingPermissions(expectedPermissions(d, claims, readOnly)...); len(missing) != 0 {
+		log.Printf("[WARN] the access token of %q in tenant %s is not granted with the permissions: %s, the requests needing them will fail", claims.Username(), claims.TenantID, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// expandClientCredential expands the credential of the AzureAD registered application, which is an empty client secret
+// for public clients.
+func expandClientCredential(d *schema.ResourceData) (msauth.ClientCredential, error) {
+	clientSecret := d.Get("client_secret").(string)
+	certPath := d.Get("client_certificate_path").(string)
+	if certPath == "" {
+		return msauth.ClientSecret(clientSecret), nil
+	}
+	if clientSecret != "" {
+		return nil, fmt.Errorf("only one of `client_secret` and `client_certificate_path` can be specified")
+	}
+	return msauth.NewClientCertificateFromFile(certPath, d.Get("client_certificate_password").(string))
+}
+
+// expandLoginOptions expands the options of the interactive login.
+func expandLoginOptions(d *schema.ResourceData) msauth.LoginOptions {
+	return msauth.LoginOptions{
+		LoginHint:  d.Get("login_hint").(string),
+		DomainHint: d.Get("domain_hint").(string),
+		Prompt:     d.Get("prompt").(string),
+	}
+}
+
+// expandFederatedToken expands the federated token of the workload identity federation, which is nil if not specified.
+func expandFederatedToken(d *schema.ResourceData) (*msauth.FederatedToken, error) {
+	tokenFile, tokenEnv := d.Get("federated_token_file").(string), d.Get("federated_token_env_var").(string)
+	switch {
+	case tokenFile != "" && tokenEnv != "":
+		return nil, fmt.Errorf("only one of `federated_token_file` and `federated_token_env_var` can be specified")
+	case tokenFile != "":
+		return msauth.NewFederatedTokenFromFile(tokenFile), nil
+	case tokenEnv != "":
+		return msauth.NewFederatedTokenFromEnv(tokenEnv), nil
+	}
+	return nil, nil
+}
+
+// newApp creates the msauth App with the token cache imported from the configured store, accordingly every obtained or
+// refreshed token will be written back to it.
+func newApp(ctx context.Context, d *schema.ResourceData) (*msauth.App, error) {
+	app := msauth.NewApp()
+	app.SetCachePassphrase(d.Get("token_cache_key").(string))
+	store, err := expandTokenCacheStore(d.Get("token_cache").([]interface{}), d.Get("token_cache_path").(string))
+	if err != nil {
+		return nil, err
+	}
+	if err := app.SyncCache(ctx, store); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+// validateAppOnlyAuth validates the provider configuration for the auth methods which acquire an app-only token.
+func validateAppOnlyAuth(method, userID, tenantID string) diag.Diagnostics {
+	// An app-only token has no signed-in user (i.e. "/me").
+	if userID == "" {
+		return diag.Errorf("either `user_id` or `user_principal_name` must be specified for auth method %q", method)
+	}
+	if tenantID == "common" || tenantID == "organizations" || tenantID == "consumers" {
+		return diag.Errorf("a specific `tenant_id` must be specified for auth method %q", method)
 	}
+	return nil
 }
@@ -0,0 +1,44 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestValidateAuthMethod(t *testing.T) {
+	cases := []struct {
+		raw map[string]interface{}
+		err string
+	}{
+		{
+			raw: map[string]interface{}{"auth_method": "device_flow"},
+		},
+		{
+			raw: map[string]interface{}{"auth_method": "password", "tenant_id": "contoso.com", "username": "john@contoso.com", "password": "secret"},
+		},
+		{
+			raw: map[string]interface{}{"auth_method": "password", "tenant_id": "contoso.com", "username": "john@contoso.com"},
+			err: "both `username` and `password` must be specified",
+		},
+		{
+			raw: map[string]interface{}{"auth_method": "password", "tenant_id": "consumers", "username": "john@outlook.com", "password": "secret"},
+			err: "either `organizations` or a specific `tenant_id` must be specified",
+		},
+		{
+			raw: map[string]interface{}{"auth_method": "client_credentials", "tenant_id": "contoso.com", "user_id": "john@contoso.com"},
+			err: "either `client_secret` or `client_certificate_path` must be specified",
+		},
+	}
+	for idx, c := range cases {
+		d := schema.TestResourceDataRaw(t, Provider().Schema, c.raw)
+		_, diags := validateAuthMethod(d, d.Get("user_id").(string))
+		switch {
+		case c.err == "" && diags.HasError():
+			t.Errorf("%d: unexpected error: %s", idx, diags[0].Summary)
+		case c.err != "" && (!diags.HasError() || !strings.Contains(diags[0].Summary, c.err)):
+			t.Errorf("%d: expect error %q, got %v", idx, c.err, diags)
+		}
+	}
+}
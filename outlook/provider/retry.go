@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/magodo/terraform-provider-outlook/outlook/clients"
+)
+
+var retrySchema = &schema.Schema{
+	Type:     schema.TypeList,
+	Optional: true,
+	MaxItems: 1,
+	MinItems: 1,
+	Elem: &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"max_retries": {
+				Type:         schema.TypeInt,
+				Description:  "The maximum number of retries of a request. `0` disables the retries.",
+				Optional:     true,
+				Default:      clients.DefaultRetryOptions.MaxRetries,
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			"min_backoff": {
+				Type:         schema.TypeString,
+				Description:  "The minimum backoff between the retries, e.g. `1s`.",
+				Optional:     true,
+				Default:      clients.DefaultRetryOptions.MinBackoff.String(),
+				ValidateFunc: validateDuration,
+			},
+			"max_backoff": {
+				Type:         schema.TypeString,
+				Description:  "The maximum backoff between the retries, e.g. `1m`.",
+				Optional:     true,
+				Default:      clients.DefaultRetryOptions.MaxBackoff.String(),
+				ValidateFunc: validateDuration,
+			},
+		},
+	},
+	Description: "The retries of the MS Graph requests, which are throttled or failed transiently.",
+}
+
+func validateDuration(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+		return nil, []error{fmt.Errorf("expected %s to be a positive duration (e.g. 30s), got %s", k, v)}
+	}
+	return nil, nil
+}
+
+func expandRetryOptions(input []interface{}) (clients.RetryOptions, error) {
+	if len(input) == 0 || input[0] == nil {
+		return clients.DefaultRetryOptions, nil
+	}
+	raw := input[0].(map[string]interface{})
+	// The durations are validated by the schema.
+	minBackoff, _ := time.ParseDuration(raw["min_backoff"].(string))
+	maxBackoff, _ := time.ParseDuration(raw["max_backoff"].(string))
+	if minBackoff > maxBackoff {
+		return clients.RetryOptions{}, fmt.Errorf("`min_backoff` (%s) must not be greater than `max_backoff` (%s)", minBackoff, maxBackoff)
+	}
+	return clients.RetryOptions{
+		MaxRetries: raw["max_retries"].(int),
+		MinBackoff: minBackoff,
+		MaxBackoff: maxBackoff,
+	}, nil
+}
@@ -0,0 +1,154 @@
+package provider
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/magodo/terraform-provider-outlook/msauth"
+	"github.com/magodo/terraform-provider-outlook/outlook/utils"
+)
+
+// resourceScope is the delegated scopes needed by a resource.
+type resourceScope struct {
+	ReadWrite []string
+	// Read is the read-only variant, which is enough for reading the resource.
+	Read []string
+}
+
+// resourceScopes are the delegated scopes needed by each resource in SupportedResources.
+var resourceScopes = map[string]resourceScope{
+	"outlook_mail_folder": {
+		ReadWrite: []string{"Mail.ReadWrite"},
+		Read:      []string{"Mail.Read"},
+	},
+	"outlook_message_rule": {
+		ReadWrite: []string{"MailboxSettings.ReadWrite"},
+		Read:      []string{"MailboxSettings.Read"},
+	},
+	"outlook_category": {
+		ReadWrite: []string{"MailboxSettings.ReadWrite"},
+		Read:      []string{"MailboxSettings.Read"},
+	},
+}
+
+// dataSourceScopes are the delegated scopes needed by each data source in SupportedDataSources.
+var dataSourceScopes = map[string][]string{
+	"outlook_mail_folder": {"Mail.Read"},
+	"outlook_category":    {"MailboxSettings.Read"},
+	"outlook_me":          {"User.Read"},
+}
+
+// isOIDCScope tells whether the scope is not about MS Graph, which is not shown as permission in the access token.
+func isOIDCScope(scope string) bool {
+	switch strings.ToLower(scope) {
+	case "offline_access", "openid", "profile", "email":
+		return true
+	}
+	return false
+}
+
+// autoScopes derives the delegated scopes needed by the supported resources and data sources (unless "resourcesOnly"),
+// where only the read-only variants are derived if "readOnly". The result excludes the scopes implied by others,
+// e.g. "Mail.Read" is implied by "Mail.ReadWrite".
+func autoScopes(readOnly, resourcesOnly bool) []string {
+	set := map[string]bool{}
+	for name := range SupportedResources() {
+		scope := resourceScopes[name]
+		scopes := scope.ReadWrite
+		if readOnly {
+			scopes = scope.Read
+		}
+		for _, s := range scopes {
+			set[s] = true
+		}
+	}
+	if !resourcesOnly {
+		for name := range SupportedDataSources() {
+			for _, s := range dataSourceScopes[name] {
+				set[s] = true
+			}
+		}
+	}
+	var scopes []string
+	for s := range set {
+		if strings.HasSuffix(s, ".Read") && set[s+"Write"] {
+			continue
+		}
+		scopes = append(scopes, s)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// qualifyScopes qualifies the MS Graph scopes by the resource of graphEndpoint (e.g.
+// "https://microsoftgraph.chinacloudapi.cn/Mail.ReadWrite"), otherwise the token is issued for the MS Graph of the
+// public cloud. The scopes of the public cloud are kept as is, as it is the default resource.
+func qualifyScopes(scopes []string, graphEndpoint string) []string {
+	if strings.EqualFold(graphEndpoint, environments["public"].GraphEndpoint) {
+		return scopes
+	}
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !isOIDCScope(scope) && !strings.Contains(scope, "://") {
+			scope = graphEndpoint + "/" + scope
+		}
+		result = append(result, scope)
+	}
+	return result
+}
+
+// scopePermission returns the permission of the scope, which is the scope without the resource, e.g. "Mail.ReadWrite"
+// for "https://graph.microsoft.us/Mail.ReadWrite".
+func scopePermission(scope string) string {
+	if !strings.Contains(scope, "://") {
+		return scope
+	}
+	return scope[strings.LastIndex(scope, "/")+1:]
+}
+
+// expandScopes returns the delegated scopes requested by the interactive auth methods, which are either specified
+// explicitly, or derived automatically (only the read-only variants if "readOnly"). They are qualified by the MS Graph
+// of the environment.
+func expandScopes(d *schema.ResourceData, env environment, readOnly bool) []string {
+	if v := d.Get("scopes").([]interface{}); len(v) != 0 {
+		return qualifyScopes(*utils.ExpandSlice(v, "", nil).(*[]string), env.GraphEndpoint)
+	}
+	// The refresh token is only issued with "offline_access".
+	return qualifyScopes(append(autoScopes(readOnly, false), "offline_access"), env.GraphEndpoint)
+}
+
+// readOnlyUntilWrite tells whether the read-only scopes are derived for the read requests until the first write request,
+// i.e. the delegated scopes are derived automatically, and `read_only` is not set. So that the plans only reading the
+// resources are never granted with the read-write permissions.
+func readOnlyUntilWrite(d *schema.ResourceData) bool {
+	if len(d.Get("scopes").([]interface{})) != 0 || d.Get("read_only").(bool) {
+		return false
+	}
+	if d.Get("access_token").(string) != "" || len(d.Get("credential_command").([]interface{})) != 0 {
+		return false
+	}
+	switch d.Get("auth_method").(string) {
+	case AUTH_METHOD_AUTH_CODE_FLOW, AUTH_METHOD_DEVICE_FLOW, AUTH_METHOD_PASSWORD, AUTH_METHOD_AUTO:
+		return true
+	}
+	return false
+}
+
+// expectedPermissions returns the permissions which the access token is expected to grant, where only the read-only
+// variants are expected if "readOnly". For app-only tokens, they are the application permissions of the same names as
+// the delegated scopes of the resources.
+func expectedPermissions(d *schema.ResourceData, claims *msauth.Claims, readOnly bool) []string {
+	// The explicitly requested scopes are only relevant to the delegated tokens.
+	if v := d.Get("scopes").([]interface{}); len(v) != 0 && claims.Scope != "" {
+		var permissions []string
+		for _, scope := range *utils.ExpandSlice(v, "", nil).(*[]string) {
+			if permission := scopePermission(scope); !isOIDCScope(permission) && permission != ".default" {
+				permissions = append(permissions, permission)
+			}
+		}
+		return permissions
+	}
+	// The scopes of the data sources are not validated, as they are not necessarily used.
+	return autoScopes(readOnly, true)
+}
@@ -0,0 +1,192 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/magodo/terraform-provider-outlook/msauth"
+)
+
+func TestQualifyScopes(t *testing.T) {
+	cases := []struct {
+		graphEndpoint string
+		in            []string
+		out           []string
+	}{
+		{
+			graphEndpoint: "https://graph.microsoft.com",
+			in:            []string{"Mail.ReadWrite", "offline_access"},
+			out:           []string{"Mail.ReadWrite", "offline_access"},
+		},
+		{
+			graphEndpoint: "https://microsoftgraph.chinacloudapi.cn",
+			in:            []string{"Mail.ReadWrite", "offline_access", "openid"},
+			out:           []string{"https://microsoftgraph.chinacloudapi.cn/Mail.ReadWrite", "offline_access", "openid"},
+		},
+		{
+			graphEndpoint: "https://graph.microsoft.us",
+			in:            []string{"https://graph.microsoft.us/Mail.Read", "User.Read"},
+			out:           []string{"https://graph.microsoft.us/Mail.Read", "https://graph.microsoft.us/User.Read"},
+		},
+	}
+	for idx, c := range cases {
+		if out := qualifyScopes(c.in, c.graphEndpoint); !reflect.DeepEqual(out, c.out) {
+			t.Errorf("%d: expect %v, got %v", idx, c.out, out)
+		}
+	}
+}
+
+func TestScopePermission(t *testing.T) {
+	cases := map[string]string{
+		"Mail.ReadWrite": "Mail.ReadWrite",
+		"https://microsoftgraph.chinacloudapi.cn/Mail.ReadWrite": "Mail.ReadWrite",
+		"https://graph.microsoft.us/.default":                    ".default",
+	}
+	for in, out := range cases {
+		if v := scopePermission(in); v != out {
+			t.Errorf("%s: expect %s, got %s", in, out, v)
+		}
+	}
+}
+
+func TestAutoScopes(t *testing.T) {
+	cases := []struct {
+		readOnly      bool
+		resourcesOnly bool
+		out           []string
+	}{
+		{
+			out: []string{"Mail.ReadWrite", "MailboxSettings.ReadWrite", "User.Read"},
+		},
+		{
+			readOnly: true,
+			out:      []string{"Mail.Read", "MailboxSettings.Read", "User.Read"},
+		},
+		{
+			resourcesOnly: true,
+			out:           []string{"Mail.ReadWrite", "MailboxSettings.ReadWrite"},
+		},
+		{
+			readOnly:      true,
+			resourcesOnly: true,
+			out:           []string{"Mail.Read", "MailboxSettings.Read"},
+		},
+	}
+	for idx, c := range cases {
+		if out := autoScopes(c.readOnly, c.resourcesOnly); !reflect.DeepEqual(out, c.out) {
+			t.Errorf("%d: expect %v, got %v", idx, c.out, out)
+		}
+	}
+}
+
+func TestAutoScopes_supported(t *testing.T) {
+	// Every supported resource and data source declares its scopes.
+	for name := range SupportedResources() {
+		if scope, ok := resourceScopes[name]; !ok || len(scope.ReadWrite) == 0 || len(scope.Read) == 0 {
+			t.Errorf("the scopes of the resource %s are not declared", name)
+		}
+	}
+	for name := range SupportedDataSources() {
+		if len(dataSourceScopes[name]) == 0 {
+			t.Errorf("the scopes of the data source %s are not declared", name)
+		}
+	}
+}
+
+func TestReadOnlyUntilWrite(t *testing.T) {
+	cases := []struct {
+		raw map[string]interface{}
+		out bool
+	}{
+		{
+			raw: map[string]interface{}{},
+			out: true,
+		},
+		{
+			raw: map[string]interface{}{"auth_method": "auto"},
+			out: true,
+		},
+		{
+			// All the requests need the read-only scopes only.
+			raw: map[string]interface{}{"read_only": true},
+			out: false,
+		},
+		{
+			raw: map[string]interface{}{"scopes": []interface{}{"Mail.ReadWrite"}},
+			out: false,
+		},
+		{
+			// The app-only tokens are granted with the application permissions, rather than the requested scopes.
+			raw: map[string]interface{}{"auth_method": "client_credentials"},
+			out: false,
+		},
+		{
+			raw: map[string]interface{}{"access_token": "foo"},
+			out: false,
+		},
+	}
+	for idx, c := range cases {
+		d := schema.TestResourceDataRaw(t, Provider().Schema, c.raw)
+		if out := readOnlyUntilWrite(d); out != c.out {
+			t.Errorf("%d: expect %t, got %t", idx, c.out, out)
+		}
+	}
+}
+
+func TestExpectedPermissions(t *testing.T) {
+	cases := []struct {
+		raw      map[string]interface{}
+		claims   msauth.Claims
+		readOnly bool
+		out      []string
+	}{
+		{
+			raw:    map[string]interface{}{},
+			claims: msauth.Claims{Scope: "Mail.ReadWrite MailboxSettings.ReadWrite User.Read"},
+			out:    []string{"Mail.ReadWrite", "MailboxSettings.ReadWrite"},
+		},
+		{
+			raw:      map[string]interface{}{"read_only": true},
+			claims:   msauth.Claims{Scope: "Mail.Read MailboxSettings.Read User.Read"},
+			readOnly: true,
+			out:      []string{"Mail.Read", "MailboxSettings.Read"},
+		},
+		{
+			// The explicitly requested scopes, excluding the OIDC ones and ".default".
+			raw:    map[string]interface{}{"scopes": []interface{}{"https://graph.microsoft.us/Mail.Read", "offline_access", "openid", ".default"}},
+			claims: msauth.Claims{Scope: "Mail.Read"},
+			out:    []string{"Mail.Read"},
+		},
+		{
+			// The requested scopes are irrelevant to the app-only tokens.
+			raw:    map[string]interface{}{"scopes": []interface{}{"Mail.Read"}},
+			claims: msauth.Claims{Roles: []string{"Mail.ReadWrite"}},
+			out:    []string{"Mail.ReadWrite", "MailboxSettings.ReadWrite"},
+		},
+	}
+	for idx, c := range cases {
+		d := schema.TestResourceDataRaw(t, Provider().Schema, c.raw)
+		if out := expectedPermissions(d, &c.claims, c.readOnly); !reflect.DeepEqual(out, c.out) {
+			t.Errorf("%d: expect %v, got %v", idx, c.out, out)
+		}
+	}
+}
+
+func TestValidateToken(t *testing.T) {
+	enc := base64.RawURLEncoding
+	payload, err := json.Marshal(map[string]interface{}{"upn": "john@contoso.com", "scp": "Mail.ReadWrite"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString(payload) + "." + enc.EncodeToString([]byte("sig"))
+
+	// The missing permissions (e.g. MailboxSettings.ReadWrite) are not needed unless the resources using them are in use.
+	d := schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{})
+	if err := validateToken(context.Background(), d, msauth.NewStaticTokenSource(token), false); err != nil {
+		t.Fatal(err)
+	}
+}
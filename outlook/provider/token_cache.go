@@ -0,0 +1,92 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/magodo/terraform-provider-outlook/msauth"
+	"github.com/magodo/terraform-provider-outlook/outlook/utils"
+)
+
+const (
+	TOKEN_CACHE_TYPE_FILE    = "file"
+	TOKEN_CACHE_TYPE_ENV     = "env"
+	TOKEN_CACHE_TYPE_COMMAND = "command"
+	TOKEN_CACHE_TYPE_MEMORY  = "memory"
+)
+
+var tokenCacheSchema = &schema.Schema{
+	Type:     schema.TypeList,
+	Optional: true,
+	MaxItems: 1,
+	MinItems: 1,
+	Elem: &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"type": {
+				Type:        schema.TypeString,
+				Description: "The backend to store the token cache.",
+				Required:    true,
+				ValidateFunc: validation.StringInSlice([]string{
+					TOKEN_CACHE_TYPE_FILE,
+					TOKEN_CACHE_TYPE_ENV,
+					TOKEN_CACHE_TYPE_COMMAND,
+					TOKEN_CACHE_TYPE_MEMORY,
+				}, false),
+			},
+			"path": {
+				Type:        schema.TypeString,
+				Description: "The token cache file path for the `file` backend. Defaults to `token_cache_path`.",
+				Optional:    true,
+			},
+			"env_var": {
+				Type:        schema.TypeString,
+				Description: "The environment variable holding the base64 encoded token cache for the `env` backend.",
+				Optional:    true,
+				Default:     "OUTLOOK_TOKEN_CACHE",
+			},
+			"command": {
+				Type:        schema.TypeList,
+				Description: "The helper command (and its arguments) for the `command` backend.",
+				Optional:    true,
+				MinItems:    1,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	},
+	Description: "The backend to store the token cache. Defaults to the file specified by `token_cache_path`.",
+}
+
+func expandTokenCacheStore(input []interface{}, defaultPath string) (msauth.TokenCacheStore, error) {
+	if len(input) == 0 || input[0] == nil {
+		if defaultPath == "" {
+			return msauth.NewMemoryTokenCacheStore(), nil
+		}
+		return msauth.NewFileTokenCacheStore(defaultPath), nil
+	}
+
+	raw := input[0].(map[string]interface{})
+	switch t := raw["type"].(string); t {
+	case TOKEN_CACHE_TYPE_FILE:
+		path := raw["path"].(string)
+		if path == "" {
+			path = defaultPath
+		}
+		if path == "" {
+			return nil, fmt.Errorf("`path` must be specified for token cache type %q", t)
+		}
+		return msauth.NewFileTokenCacheStore(path), nil
+	case TOKEN_CACHE_TYPE_ENV:
+		return msauth.NewEnvTokenCacheStore(raw["env_var"].(string)), nil
+	case TOKEN_CACHE_TYPE_COMMAND:
+		command := *utils.ExpandSlice(raw["command"].([]interface{}), "", nil).(*[]string)
+		if len(command) == 0 {
+			return nil, fmt.Errorf("`command` must be specified for token cache type %q", t)
+		}
+		return msauth.NewCommandTokenCacheStore(command...), nil
+	case TOKEN_CACHE_TYPE_MEMORY:
+		return msauth.NewMemoryTokenCacheStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown token cache type: %s", t)
+	}
+}
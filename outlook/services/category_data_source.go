@@ -37,9 +37,8 @@ func dataSourceOutlookCategoryRead(ctx context.Context, d *schema.ResourceData,
 
 	name := d.Get("name").(string)
 
-	req := client.Request()
 	// we do not use filter here since the filter in category list API does not work
-	objs, err := req.Get(ctx)
+	objs, err := client.List(ctx)
 	if err != nil {
 		return diag.FromErr(err)
 	}
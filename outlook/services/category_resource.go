@@ -86,9 +86,8 @@ func resourceArmCategoryCreate(ctx context.Context, d *schema.ResourceData, meta
 	name := d.Get("name").(string)
 
 	if d.IsNewResource() {
-		req := client.Request()
 		// we do not use filter here since the filter in category list API does not work
-		objs, err := req.Get(ctx)
+		objs, err := client.List(ctx)
 		if err != nil {
 			return diag.FromErr(err)
 		}
@@ -103,7 +102,7 @@ func resourceArmCategoryCreate(ctx context.Context, d *schema.ResourceData, meta
 		Color:       expandCategoryColor(colorMap, d.Get("color").(string)),
 	}
 
-	resp, err := client.Request().Add(ctx, param)
+	resp, err := client.Create(ctx, param)
 	if err != nil {
 		return diag.Errorf("creating Outlook Category %q: %+v", name, err)
 	}
@@ -119,7 +118,7 @@ func resourceArmCategoryCreate(ctx context.Context, d *schema.ResourceData, meta
 func resourceArmCategoryRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*clients.Client).Categories
 
-	resp, err := client.ID(d.Id()).Request().Get(ctx)
+	resp, err := client.Get(ctx, d.Id())
 	if err != nil {
 		if utils.ResponseErrorWasNotFound(err) {
 			log.Printf("[WARN] Outlook Category %q does not exist - removing from state", d.Id())
@@ -146,7 +145,7 @@ func resourceArmCategoryUpdate(ctx context.Context, d *schema.ResourceData, meta
 		param.Color = expandCategoryColor(colorMap, d.Get("color").(string))
 	}
 
-	if err := client.ID(d.Id()).Request().Update(ctx, &param); err != nil {
+	if err := client.Update(ctx, d.Id(), &param); err != nil {
 		return diag.Errorf("updating Outlook Category %q: %+v", d.Get("name").(string), err)
 	}
 
@@ -156,7 +155,7 @@ func resourceArmCategoryUpdate(ctx context.Context, d *schema.ResourceData, meta
 func resourceArmCategoryDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*clients.Client).Categories
 
-	if err := client.ID(d.Id()).Request().Delete(ctx); err != nil {
+	if err := client.Delete(ctx, d.Id()); err != nil {
 		return diag.Errorf("deleting Outlook Category %q: %+v", d.Get("name").(string), err)
 	}
 
@@ -1,11 +1,15 @@
 package services_test
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/magodo/terraform-provider-outlook/outlook/clients/clientstest"
+	"github.com/magodo/terraform-provider-outlook/outlook/services"
 )
 
 func TestAccOutlookCategory_basic(t *testing.T) {
@@ -64,3 +68,35 @@ resource "outlook_category" "test" {
 }
 `, suffix)
 }
+
+func TestOutlookCategory_createExisting(t *testing.T) {
+	fakes := clientstest.NewFakes()
+	r := services.ResourceCategory()
+	ctx := context.Background()
+
+	d := newResourceData(t, r, map[string]interface{}{"name": "foo", "color": "Red"})
+	if diags := r.CreateContext(ctx, d, fakes.Client()); diags.HasError() {
+		t.Fatalf("creating: %+v", diags)
+	}
+	if got := d.Get("color").(string); got != "Red" {
+		t.Fatalf("expect color Red, got %q", got)
+	}
+
+	existing := newResourceData(t, r, map[string]interface{}{"name": "foo"})
+	diags := r.CreateContext(ctx, existing, fakes.Client())
+	if !diags.HasError() || !strings.Contains(diags[0].Summary, d.Id()) {
+		t.Fatalf("expect the import as exists error of %q, got %+v", d.Id(), diags)
+	}
+}
+
+func TestOutlookCategory_deleteNotFound(t *testing.T) {
+	fakes := clientstest.NewFakes()
+	r := services.ResourceCategory()
+
+	d := newResourceData(t, r, map[string]interface{}{"name": "foo"})
+	d.SetId("8f1c2d3e-4b5a-4c6d-9e7f-0a1b2c3d4e5f")
+	diags := r.DeleteContext(context.Background(), d, fakes.Client())
+	if !diags.HasError() || !strings.Contains(diags[0].Summary, "ErrorItemNotFound") {
+		t.Fatalf("expect the not found error, got %+v", diags)
+	}
+}
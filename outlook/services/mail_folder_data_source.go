@@ -1,7 +1,6 @@
 package services
 
 import (
-	"fmt"
 	"time"
 
 	"context"
@@ -72,24 +71,12 @@ func dataSourceMailRead(ctx context.Context, d *schema.ResourceData, meta interf
 	var obj *msgraph.MailFolder
 	if wellKnownName != "" {
 		var err error
-		obj, err = client.ID(wellKnownName).Request().Get(ctx)
+		obj, err = client.Get(ctx, wellKnownName)
 		if err != nil {
 			return diag.FromErr(err)
 		}
 	} else {
-		var (
-			objs []msgraph.MailFolder
-			err  error
-		)
-		if parent == "" {
-			req := client.Request()
-			req.Filter(fmt.Sprintf(`displayName eq '%s'`, name))
-			objs, err = req.Get(ctx)
-		} else {
-			req := client.ID(parent).ChildFolders().Request()
-			req.Filter(fmt.Sprintf(`displayName eq '%s'`, name))
-			objs, err = req.Get(ctx)
-		}
+		objs, err := client.List(ctx, parent, name)
 		if err != nil {
 			return diag.FromErr(err)
 		}
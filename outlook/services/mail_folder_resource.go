@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
@@ -52,9 +53,7 @@ func resourceMailFolderCreate(ctx context.Context, d *schema.ResourceData, meta
 	parent := d.Get("parent_folder_id").(string)
 
 	if d.IsNewResource() {
-		req := client.Request()
-		req.Filter(fmt.Sprintf(`displayName eq '%s'`, name))
-		objs, err := req.Get(ctx)
+		objs, err := client.List(ctx, "", name)
 		if err != nil {
 			return diag.FromErr(err)
 		}
@@ -67,16 +66,7 @@ func resourceMailFolderCreate(ctx context.Context, d *schema.ResourceData, meta
 		DisplayName: utils.String(name),
 	}
 
-	var (
-		resp *msgraph.MailFolder
-		err  error
-	)
-	if parent == "" {
-		resp, err = client.Request().Add(ctx, param)
-	} else {
-		resp, err = client.ID(parent).ChildFolders().Request().Add(ctx, param)
-	}
-
+	resp, err := client.Create(ctx, parent, param)
 	if err != nil {
 		return diag.Errorf("creating Mail Folder %q: %+v", name, err)
 	}
@@ -92,7 +82,7 @@ func resourceMailFolderCreate(ctx context.Context, d *schema.ResourceData, meta
 func resourceMailFolderRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*clients.Client).MailFolders
 
-	resp, err := client.ID(d.Id()).Request().Get(ctx)
+	resp, err := client.Get(ctx, d.Id())
 	if err != nil {
 		if utils.ResponseErrorWasNotFound(err) {
 			log.Printf("[WARN] Mail Folder %q doesn't exist - removing from state", d.Id())
@@ -108,13 +98,13 @@ func resourceMailFolderRead(ctx context.Context, d *schema.ResourceData, meta in
 }
 
 func resourceMailFolderUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	client := meta.(*clients.Client).MailFolders.ID(d.Id())
+	client := meta.(*clients.Client).MailFolders
 
 	var param msgraph.MailFolder
 	if d.HasChange("name") {
 		param.DisplayName = utils.String(d.Get("name").(string))
 	}
-	if err := client.Request().Update(ctx, &param); err != nil {
+	if err := client.Update(ctx, d.Id(), &param); err != nil {
 		return diag.FromErr(err)
 	}
 
@@ -125,7 +115,7 @@ func resourceMailFolderDelete(ctx context.Context, d *schema.ResourceData, meta
 	client := meta.(*clients.Client).MailFolders
 
 	// Avoid to delete the folder when it has child folder
-	children, err := client.ID(d.Id()).ChildFolders().Request().Get(ctx)
+	children, err := client.List(ctx, d.Id(), "")
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -134,35 +124,18 @@ func resourceMailFolderDelete(ctx context.Context, d *schema.ResourceData, meta
 	}
 
 	// Move the containing messages back to inbox before deleting the folder.
-	inboxFolder, err := client.ID("inbox").Request().Get(ctx)
+	inboxFolder, err := client.Get(ctx, "inbox")
 	if err != nil {
 		return diag.FromErr(err)
 	}
 	inboxFolderID := inboxFolder.ID
-	messages, err := client.ID(d.Id()).Messages().Request().Get(ctx)
-	if err != nil {
-		return diag.Errorf("listing messages under mail folder: %+v", err)
-	}
-
-	for _, msg := range messages {
-		if msg.ID == nil {
-			continue
-		}
-		if _, err := client.ID(d.Id()).Messages().ID(*msg.ID).
-			Move(
-				&msgraph.MessageMoveRequestParameter{
-					DestinationID: inboxFolderID,
-				},
-			).Request().Post(ctx); err != nil {
-			if err != nil {
-				return diag.FromErr(fmt.Errorf("moving message %s: %+v", *msg.ID, err))
-			}
-		}
+	if err := moveMailFolderMessages(ctx, client, d.Id(), *inboxFolderID); err != nil {
+		return diag.FromErr(err)
 	}
 
 	// Double check whether containing messages are all moved out the folder, in order to avoid
 	// deleting any message by accident (e.g. because of API synchronizationation drift).
-	messages, err = client.ID(d.Id()).Messages().Request().Get(ctx)
+	messages, err := client.ListMessageIDs(ctx, d.Id())
 	if err != nil {
 		return diag.Errorf("listing messages again under mail folder: %+v", err)
 	}
@@ -171,8 +144,44 @@ func resourceMailFolderDelete(ctx context.Context, d *schema.ResourceData, meta
 	}
 
 	// Delete the folder
-	if err := client.ID(d.Id()).Request().Delete(ctx); err != nil {
+	if err := client.Delete(ctx, d.Id()); err != nil {
 		return diag.FromErr(err)
 	}
 	return nil
 }
+
+// moveMailFolderMessages moves all the messages in the mail folder to the destination folder.
+func moveMailFolderMessages(ctx context.Context, client clients.MailFolderService, folderID, destinationID string) error {
+	ids, err := client.ListMessageIDs(ctx, folderID)
+	if err != nil {
+		return fmt.Errorf("listing messages under mail folder: %+v", err)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	log.Printf("[INFO] moving %d messages from mail folder %q", len(ids), folderID)
+
+	errs, err := client.MoveMessages(ctx, folderID, ids, destinationID)
+	if err != nil {
+		return fmt.Errorf("moving messages: %+v", err)
+	}
+
+	// Only report the first few failures, as they are likely the same.
+	const maxReportedFailures = 5
+	var (
+		nfailure int
+		failures []string
+	)
+	for i, err := range errs {
+		if err != nil {
+			nfailure++
+			if len(failures) < maxReportedFailures {
+				failures = append(failures, fmt.Sprintf("moving message %s: %+v", ids[i], err))
+			}
+		}
+	}
+	if nfailure != 0 {
+		return fmt.Errorf("failed to move %d of %d messages:\n%s", nfailure, len(ids), strings.Join(failures, "\n"))
+	}
+	return nil
+}
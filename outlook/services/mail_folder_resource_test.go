@@ -1,11 +1,17 @@
 package services_test
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/magodo/terraform-provider-outlook/outlook/clients/clientstest"
+	"github.com/magodo/terraform-provider-outlook/outlook/services"
+	"github.com/magodo/terraform-provider-outlook/outlook/utils"
 )
 
 func TestAccMailFolderResource_basic(t *testing.T) {
@@ -90,3 +96,104 @@ resource "outlook_mail_folder" "test_child" {
 }
 `, suffix)
 }
+
+func TestMailFolderResource_create(t *testing.T) {
+	fakes := clientstest.NewFakes()
+	r := services.ResourceMailFolder()
+	ctx := context.Background()
+
+	d := newResourceData(t, r, map[string]interface{}{"name": "foo"})
+	if diags := r.CreateContext(ctx, d, fakes.Client()); diags.HasError() {
+		t.Fatalf("creating: %+v", diags)
+	}
+	if d.Id() == "" {
+		t.Fatal("empty ID")
+	}
+	if got := d.Get("parent_folder_id").(string); got == "" {
+		t.Fatal("empty parent folder ID")
+	}
+
+	child := newResourceData(t, r, map[string]interface{}{"name": "bar", "parent_folder_id": d.Id()})
+	if diags := r.CreateContext(ctx, child, fakes.Client()); diags.HasError() {
+		t.Fatalf("creating the child folder: %+v", diags)
+	}
+	if got := child.Get("parent_folder_id").(string); got != d.Id() {
+		t.Fatalf("expect the parent folder ID %q, got %q", d.Id(), got)
+	}
+
+	// A new folder with the name of an existing one should be imported instead.
+	existing := newResourceData(t, r, map[string]interface{}{"name": "foo"})
+	diags := r.CreateContext(ctx, existing, fakes.Client())
+	if !diags.HasError() || !strings.Contains(diags[0].Summary, "already exists") {
+		t.Fatalf("expect the import as exists error, got %+v", diags)
+	}
+}
+
+func TestMailFolderResource_readNotFound(t *testing.T) {
+	fakes := clientstest.NewFakes()
+	r := services.ResourceMailFolder()
+
+	d := newResourceData(t, r, map[string]interface{}{"name": "foo"})
+	d.SetId("AQMkADAwATM0MDAAMS1iNTcwLWI2NTEtMDACLTAwCgAuAAAD")
+	if diags := r.ReadContext(context.Background(), d, fakes.Client()); diags.HasError() {
+		t.Fatalf("reading: %+v", diags)
+	}
+	if d.Id() != "" {
+		t.Fatalf("expect the resource to be removed from state, got ID %q", d.Id())
+	}
+}
+
+func TestMailFolderResource_deleteMovesMessages(t *testing.T) {
+	fakes := clientstest.NewFakes()
+	r := services.ResourceMailFolder()
+	ctx := context.Background()
+
+	d := newResourceData(t, r, map[string]interface{}{"name": "foo"})
+	if diags := r.CreateContext(ctx, d, fakes.Client()); diags.HasError() {
+		t.Fatalf("creating: %+v", diags)
+	}
+	fakes.MailFolders.AddMessages(d.Id(), 45)
+
+	if diags := r.DeleteContext(ctx, d, fakes.Client()); diags.HasError() {
+		t.Fatalf("deleting: %+v", diags)
+	}
+	if _, err := fakes.MailFolders.Get(ctx, d.Id()); !utils.ResponseErrorWasNotFound(err) {
+		t.Fatalf("expect the folder to be deleted, got %v", err)
+	}
+	ids, err := fakes.MailFolders.ListMessageIDs(ctx, "inbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 45 {
+		t.Fatalf("expect 45 messages moved to inbox, got %d", len(ids))
+	}
+}
+
+func TestMailFolderResource_deleteMoveFailure(t *testing.T) {
+	fakes := clientstest.NewFakes()
+	r := services.ResourceMailFolder()
+	ctx := context.Background()
+
+	d := newResourceData(t, r, map[string]interface{}{"name": "foo"})
+	if diags := r.CreateContext(ctx, d, fakes.Client()); diags.HasError() {
+		t.Fatalf("creating: %+v", diags)
+	}
+	ids := fakes.MailFolders.AddMessages(d.Id(), 3)
+	fakes.MailFolders.MoveErrors[ids[1]] = clientstest.NewError(http.StatusForbidden, "ErrorAccessDenied", "Access is denied.")
+
+	diags := r.DeleteContext(ctx, d, fakes.Client())
+	if !diags.HasError() {
+		t.Fatal("expect an error")
+	}
+	if !strings.Contains(diags[0].Summary, "failed to move 1 of 3 messages") || !strings.Contains(diags[0].Summary, ids[1]) {
+		t.Fatalf("unexpected error: %s", diags[0].Summary)
+	}
+	// The folder is kept, together with the message failed to move.
+	remaining, err := fakes.MailFolders.ListMessageIDs(ctx, d.Id())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 1 || remaining[0] != ids[1] {
+		t.Fatalf("expect the message %q to remain, got %v", ids[1], remaining)
+	}
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/magodo/terraform-provider-outlook/outlook/clients"
+)
+
+func DataSourceMe() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceMeRead,
+
+		Timeouts: &schema.ResourceTimeout{
+			Read: schema.DefaultTimeout(5 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"user_principal_name": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"display_name": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"mail": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"tenant_id": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func dataSourceMeRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*clients.Client)
+
+	user, err := client.User.Request().Get(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	if user.ID == nil || *user.ID == "" {
+		return diag.Errorf("empty of nil ID returned for the user")
+	}
+
+	// The tenant is only known from the claims of the access token, which is opaque for personal Microsoft accounts.
+	var tenantID string
+	if claims, err := client.TokenClaims(); err == nil {
+		tenantID = claims.TenantID
+	} else {
+		log.Printf("[DEBUG] decoding access token claims: %v", err)
+	}
+
+	d.SetId(*user.ID)
+	d.Set("user_principal_name", user.UserPrincipalName)
+	d.Set("display_name", user.DisplayName)
+	d.Set("mail", user.Mail)
+	d.Set("tenant_id", tenantID)
+
+	return nil
+}
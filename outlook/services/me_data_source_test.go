@@ -0,0 +1,29 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+)
+
+func TestAccOutlookMeDataSource_basic(t *testing.T) {
+	resource.ParallelTest(t, resource.TestCase{
+		PreCheck:          func() { preCheck(t) },
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccDsOutlookMe_basic(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet("data.outlook_me.test", "id"),
+					resource.TestCheckResourceAttrSet("data.outlook_me.test", "user_principal_name"),
+				),
+			},
+		},
+	})
+}
+
+func testAccDsOutlookMe_basic() string {
+	return `
+data "outlook_me" "test" {}
+`
+}
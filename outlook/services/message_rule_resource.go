@@ -2,7 +2,6 @@ package services
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"math"
 	"time"
@@ -340,9 +339,7 @@ func resourceMessageRuleCreate(ctx context.Context, d *schema.ResourceData, meta
 	name := d.Get("name").(string)
 
 	if d.IsNewResource() {
-		req := client.Request()
-		req.Filter(fmt.Sprintf(`displayName eq '%s'`, name))
-		objs, err := req.Get(ctx)
+		objs, err := client.List(ctx, name)
 		if err != nil {
 			return diag.FromErr(err)
 		}
@@ -364,7 +361,7 @@ func resourceMessageRuleCreate(ctx context.Context, d *schema.ResourceData, meta
 		Actions:     expandMessageRuleAction(d.Get("action").([]interface{})),
 	}
 
-	resp, err := client.Request().Add(ctx, param)
+	resp, err := client.Create(ctx, param)
 	if err != nil {
 		return diag.Errorf("creating Message Rule %q: %+v", name, err)
 	}
@@ -380,7 +377,7 @@ func resourceMessageRuleCreate(ctx context.Context, d *schema.ResourceData, meta
 func resourceMessageRuleRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*clients.Client).MessageRules
 
-	resp, err := client.ID(d.Id()).Request().Get(ctx)
+	resp, err := client.Get(ctx, d.Id())
 	if err != nil {
 		if utils.MessageResponseErrorWasNotFound(err) {
 			log.Printf("[WARN] Message Rule %q doesn't exist - removing from state", d.Id())
@@ -437,7 +434,7 @@ func resourceMessageRuleUpdate(ctx context.Context, d *schema.ResourceData, meta
 		param.Actions = expandMessageRuleAction(d.Get("action").([]interface{}))
 	}
 
-	if err := client.ID(d.Id()).Request().Update(ctx, &param); err != nil {
+	if err := client.Update(ctx, d.Id(), &param); err != nil {
 		return diag.FromErr(err)
 	}
 
@@ -446,7 +443,7 @@ func resourceMessageRuleUpdate(ctx context.Context, d *schema.ResourceData, meta
 
 func resourceMessageRuleDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*clients.Client).MessageRules
-	if err := client.ID(d.Id()).Request().Delete(ctx); err != nil {
+	if err := client.Delete(ctx, d.Id()); err != nil {
 		return diag.FromErr(err)
 	}
 	return nil
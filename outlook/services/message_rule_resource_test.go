@@ -1,11 +1,17 @@
 package services_test
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/magodo/terraform-provider-outlook/outlook/clients/clientstest"
+	"github.com/magodo/terraform-provider-outlook/outlook/services"
 )
 
 func TestAccMessageRuleResource_basic(t *testing.T) {
@@ -189,3 +195,115 @@ resource "outlook_message_rule" "test3" {
 }
 `, suffix)
 }
+
+func TestMessageRuleResource_expandFlatten(t *testing.T) {
+	fakes := clientstest.NewFakes()
+	r := services.ResourceMessageRule()
+	ctx := context.Background()
+
+	raw := map[string]interface{}{
+		"name":     "msgrule",
+		"sequence": 2,
+		"enabled":  true,
+		"condition": []interface{}{
+			map[string]interface{}{
+				"from_addresses":     []interface{}{"foo@bar.com"},
+				"importance":         "high",
+				"is_meeting_request": true,
+				"within_size_range": []interface{}{
+					map[string]interface{}{"min_size": 10, "max_size": 100},
+				},
+			},
+		},
+		"action": []interface{}{
+			map[string]interface{}{
+				"mark_as_read":      true,
+				"assign_categories": []interface{}{"Red category"},
+			},
+		},
+	}
+	d := newResourceData(t, r, raw)
+	if diags := r.CreateContext(ctx, d, fakes.Client()); diags.HasError() {
+		t.Fatalf("creating: %+v", diags)
+	}
+
+	// Read the rule created in the fake into a fresh state, which should match the configuration.
+	read := newResourceData(t, r, map[string]interface{}{})
+	read.SetId(d.Id())
+	if diags := r.ReadContext(ctx, read, fakes.Client()); diags.HasError() {
+		t.Fatalf("reading: %+v", diags)
+	}
+	for _, key := range []string{
+		"name",
+		"sequence",
+		"enabled",
+		"condition.0.importance",
+		"condition.0.is_meeting_request",
+		"condition.0.within_size_range.0.min_size",
+		"condition.0.within_size_range.0.max_size",
+		"action.0.mark_as_read",
+	} {
+		if got, expect := read.Get(key), d.Get(key); got != expect {
+			t.Errorf("%s: expect %v, got %v", key, expect, got)
+		}
+	}
+	for _, key := range []string{"condition.0.from_addresses", "action.0.assign_categories"} {
+		if got, expect := read.Get(key).(*schema.Set), d.Get(key).(*schema.Set); !got.Equal(expect) {
+			t.Errorf("%s: expect %v, got %v", key, expect.List(), got.List())
+		}
+	}
+}
+
+func TestMessageRuleResource_updateRemovesCondition(t *testing.T) {
+	fakes := clientstest.NewFakes()
+	r := services.ResourceMessageRule()
+	ctx := context.Background()
+
+	raw := map[string]interface{}{
+		"name": "msgrule",
+		"condition": []interface{}{
+			map[string]interface{}{"subject_contains": []interface{}{"foo"}},
+		},
+		"action": []interface{}{
+			map[string]interface{}{"mark_as_read": true},
+		},
+	}
+	d := newResourceData(t, r, raw)
+	if diags := r.CreateContext(ctx, d, fakes.Client()); diags.HasError() {
+		t.Fatalf("creating: %+v", diags)
+	}
+
+	// The removed condition should be zeroed in the request, instead of being omitted.
+	delete(raw, "condition")
+	d = updatedResourceData(t, r, d, raw)
+	if diags := r.UpdateContext(ctx, d, fakes.Client()); diags.HasError() {
+		t.Fatalf("updating: %+v", diags)
+	}
+	rule, err := fakes.MessageRules.Get(ctx, d.Id())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Conditions != nil && len(rule.Conditions.SubjectContains) != 0 {
+		t.Fatalf("expect the condition to be removed, got %v", rule.Conditions.SubjectContains)
+	}
+}
+
+func TestMessageRuleResource_createError(t *testing.T) {
+	fakes := clientstest.NewFakes()
+	fakes.MessageRules.Errors["Create"] = clientstest.NewError(http.StatusBadRequest, "ErrorInvalidRequest", "The rule is invalid.")
+	r := services.ResourceMessageRule()
+
+	d := newResourceData(t, r, map[string]interface{}{
+		"name": "msgrule",
+		"action": []interface{}{
+			map[string]interface{}{"mark_as_read": true},
+		},
+	})
+	diags := r.CreateContext(context.Background(), d, fakes.Client())
+	if !diags.HasError() || !strings.Contains(diags[0].Summary, "ErrorInvalidRequest") {
+		t.Fatalf("expect the error of the fake, got %+v", diags)
+	}
+	if d.Id() != "" {
+		t.Fatalf("expect no ID, got %q", d.Id())
+	}
+}
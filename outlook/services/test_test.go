@@ -1,35 +1,67 @@
 package services_test
 
 import (
+	"context"
 	"os"
+	"sync"
 	"testing"
 
 	"github.com/magodo/terraform-provider-outlook/msauth"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/magodo/terraform-provider-outlook/outlook/graphtest"
 	"github.com/magodo/terraform-provider-outlook/outlook/provider"
 )
 
+// fakeGraph is the fake MS Graph shared by the acceptance tests running offline.
+var fakeGraph struct {
+	once   sync.Once
+	server *graphtest.Server
+}
+
 func preCheck(t *testing.T) {
-	variables := []string{
-		"OUTLOOK_TOKEN_CACHE_PATH",
+	// The password auth method signs in headless, e.g. for the service accounts of a dedicated test tenant.
+	if os.Getenv("OUTLOOK_AUTH_METHOD") == "password" {
+		for _, variable := range []string{"OUTLOOK_TENANT_ID", "OUTLOOK_USERNAME", "OUTLOOK_PASSWORD"} {
+			if os.Getenv(variable) == "" {
+				t.Fatalf("`%s` must be set for acceptance tests with the password auth method!", variable)
+			}
+		}
+		return
 	}
 
-	for _, variable := range variables {
-		value := os.Getenv(variable)
-		if value == "" {
-			t.Fatalf("`%s` must be set for acceptance tests!", variable)
-		}
+	// Without a real mailbox, the acceptance tests run against the fake MS Graph.
+	path := os.Getenv("OUTLOOK_TOKEN_CACHE_PATH")
+	if path == "" {
+		preCheckOffline(t)
+		return
 	}
 
 	app := msauth.NewApp()
-	path := os.Getenv("OUTLOOK_TOKEN_CACHE_PATH")
+	app.SetCachePassphrase(os.Getenv("OUTLOOK_TOKEN_CACHE_KEY"))
 	if err := app.ImportCache(path); err != nil {
 		t.Fatalf("importing auth cache from %s: %+v", path, err)
 	}
 }
 
+// preCheckOffline points the provider to the fake MS Graph via the `graph_endpoint` and `access_token`, which is
+// started once and shared by the tests of the package until the test binary exits.
+func preCheckOffline(t *testing.T) {
+	fakeGraph.once.Do(func() {
+		fakeGraph.server = graphtest.NewServer()
+	})
+	for variable, value := range map[string]string{
+		"OUTLOOK_GRAPH_ENDPOINT": fakeGraph.server.URL,
+		"OUTLOOK_ACCESS_TOKEN":   fakeGraph.server.AccessToken(),
+	} {
+		if err := os.Setenv(variable, value); err != nil {
+			t.Fatalf("setting %s: %+v", variable, err)
+		}
+	}
+}
+
 var providerFactories = map[string]func() (*schema.Provider, error){
 	"outlook": func() (*schema.Provider, error) {
 		return provider.Provider(), nil
@@ -49,3 +81,26 @@ func importStep(name string, ignore ...string) resource.TestStep {
 
 	return step
 }
+
+// newResourceData returns the ResourceData of a new resource configured by raw, for the unit tests running the CRUD
+// functions of the resource against the fakes of clientstest.
+func newResourceData(t *testing.T, r *schema.Resource, raw map[string]interface{}) *schema.ResourceData {
+	d := schema.TestResourceDataRaw(t, r.Schema, raw)
+	d.MarkNewResource()
+	return d
+}
+
+// updatedResourceData returns the ResourceData of an existing resource (in the state of d) reconfigured by raw, for
+// the unit tests of the update function.
+func updatedResourceData(t *testing.T, r *schema.Resource, d *schema.ResourceData, raw map[string]interface{}) *schema.ResourceData {
+	m := schema.InternalMap(r.Schema)
+	diff, err := m.Diff(context.Background(), d.State(), terraform.NewResourceConfigRaw(raw), nil, nil, true)
+	if err != nil {
+		t.Fatalf("diffing: %+v", err)
+	}
+	updated, err := m.Data(d.State(), diff)
+	if err != nil {
+		t.Fatalf("creating resource data: %+v", err)
+	}
+	return updated
+}